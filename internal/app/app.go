@@ -3,10 +3,16 @@ package app
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/mirror"
 	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/patcher"
 	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/signer"
 	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/sourcefileproviders"
@@ -14,7 +20,10 @@ import (
 	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/sourcefileproviders/localfile"
 	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/sourcefileproviders/remoteurl"
 	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/types"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/metrics"
 	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/server"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/signapi"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/tracing"
 
 	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins"
 )
@@ -41,47 +50,121 @@ func App(ctx context.Context, version string) error {
 
 	log.Infof("Jenkins update.json ResignerService (v%s) starting up...", version)
 
-	var sourceFileProvider sourcefileproviders.Provider
+	switch cfg.Command {
+	case config.CommandSigningLogVerify, config.CommandSigningLogLookup:
+		return runSigningLog(log, cfg)
+	case config.CommandVerify:
+		return runVerify(ctx, log, cfg)
+	case config.CommandGenCert:
+		return runGenCert(log, cfg.GenCert)
+	}
+
+	shutdownTracing, err := tracing.Setup(ctx, log.With("component", "tracing"), cfg.Tracing, version)
+	if err != nil {
+		return fmt.Errorf("cannot initialize tracing: %w", err)
+	}
 
-	if cfg.Source.URL != "" {
-		sourceFileProvider, err = remoteurl.NewRemoteURLProvider(log.With("component", "remote-url-provider"), cfg.Source.URL)
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
 
-		if cfg.UpdateJSONCacheTTL > 0 {
-			log.Infof("initializing caching wrapper (cache TTL = %s)", cfg.UpdateJSONCacheTTL)
-			sourceFileProvider, err = cache.NewCacheWrapper(ctx, log.With("component", "cache-wrapper"), sourceFileProvider, cfg.UpdateJSONCacheTTL)
-			if err != nil {
-				return fmt.Errorf("cannot initialize cache wrapper: %w", err)
-			}
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			log.Warnf("cannot flush traces: %v", err)
 		}
-	} else {
-		sourceFileProvider, err = localfile.NewLocalFileProvider(cfg.Source.Path)
-	}
+	}()
+
+	sourceFileProvider, err := newSourceFileProvider(ctx, log, cfg)
 	if err != nil {
 		return fmt.Errorf("cannot initialize source file provider: %w", err)
 	}
 
+	switch cfg.Command {
+	case config.CommandAuditMirror:
+		return runMirrorAudit(ctx, log, cfg, sourceFileProvider)
+	case config.CommandSign:
+		return runSign(ctx, log, cfg, sourceFileProvider)
+	}
+
 	signerSvc, err := signer.NewSignerService(log.With("component", "signer"), cfg.Signer)
 	if err != nil {
 		return fmt.Errorf("cannot initialize signer: %w", err)
 	}
 
-	patchers := []types.Patcher{
-		patcher.NewPatcher(log.With("component", "patcher"), cfg.Patch),
+	defer func() {
+		if err := signerSvc.Close(); err != nil {
+			log.Warnf("cannot close signer: %v", err)
+		}
+	}()
+
+	go signerSvc.RunExpiryMonitor(ctx)
+
+	metrics.RegisterSigningCertificate(func() time.Time {
+		return signerSvc.CertificateInfo().NotAfter
+	})
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+
+	go signerSvc.RunReloader(ctx, reload)
+
+	upstreamVerifier, err := newUpstreamVerifier(log, cfg, signerSvc)
+	if err != nil {
+		return err
 	}
 
-	juc := jenkins.NewJenkinsUpdateCenter(log.With("component", "juc"), cfg, sourceFileProvider, signerSvc, patchers)
+	juc := jenkins.NewJenkinsUpdateCenter(log.With("component", "juc"), cfg, sourceFileProvider, upstreamVerifier, signerSvc, newPatchers(log, cfg))
 
 	if err := juc.RefreshContent(ctx); err != nil {
 		return fmt.Errorf("cannot refresh content: %w", err)
 	}
 
+	go juc.RunRefresher(ctx)
+
 	defer func() {
 		if err := juc.CleanUp(context.Background()); err != nil {
 			log.Warnf(fmt.Sprintf("cannot clean up: %v", err))
 		}
 	}()
 
-	srv, err := server.NewServer(log.With("component", "server"), cfg.Server, juc, cfg.DataDirPath, cfg.RealMirrorURL)
+	var mirrorAuditor server.MirrorAuditReporter
+
+	if cfg.MirrorAudit.Interval > 0 {
+		auditor := mirror.NewAuditor(log.With("component", "mirror-audit"), cfg.MirrorAudit, cfg.Patch.NewDownloadURL)
+		go auditor.RunWorker(ctx, juc)
+
+		mirrorAuditor = auditor
+	}
+
+	var mirrorPicker server.MirrorPicker
+
+	if cfg.Server.DownloadMode == config.DownloadModeRedirect {
+		pool, err := mirror.NewPool(log.With("component", "mirror-pool"), cfg.Redirect, cfg.RealMirrorURL)
+		if err != nil {
+			return fmt.Errorf("cannot initialize redirect mirrors: %w", err)
+		}
+		go pool.RunHealthChecker(ctx)
+
+		mirrorPicker = pool
+	}
+
+	var signAPI http.Handler
+
+	if cfg.SignAPI.TokensPath != "" {
+		if signAPI, err = signapi.NewService(log.With("component", "sign-api"), cfg.SignAPI, signerSvc); err != nil {
+			return fmt.Errorf("cannot initialize signing API: %w", err)
+		}
+	}
+
+	srv, err := server.NewServer(log.With("component", "server"), cfg.Server, server.Dependencies{
+		UpdateCenter:        juc,
+		SigningCertificates: signerSvc,
+		MirrorAuditor:       mirrorAuditor,
+		MirrorPicker:        mirrorPicker,
+		SignAPI:             signAPI,
+		DataDir:             cfg.DataDirPath,
+		ProxyToURL:          cfg.RealMirrorURL,
+	})
 	if err != nil {
 		return fmt.Errorf("cannot initialize server: %w", err)
 	}
@@ -92,3 +175,49 @@ func App(ctx context.Context, version string) error {
 
 	return nil
 }
+
+func newSourceFileProvider(ctx context.Context, log *zap.SugaredLogger, cfg config.AppConfig) (sourcefileproviders.Provider, error) {
+	if cfg.Source.URL == "" {
+		return localfile.NewLocalFileProvider(cfg.Source.Path)
+	}
+
+	sourceFileProvider, err := remoteurl.NewRemoteURLProvider(log.With("component", "remote-url-provider"), cfg.Source.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.UpdateJSONCacheTTL > 0 && cfg.Command == "" {
+		log.Infof("initializing caching wrapper (cache TTL = %s)", cfg.UpdateJSONCacheTTL)
+
+		return cache.NewCacheWrapper(ctx, log.With("component", "cache-wrapper"), sourceFileProvider, cfg.UpdateJSONCacheTTL)
+	}
+
+	return sourceFileProvider, nil
+}
+
+func newUpstreamVerifier(log *zap.SugaredLogger, cfg config.AppConfig, signerSvc *signer.Service) (types.SignatureVerifier, error) {
+	if cfg.Source.TrustStorePath == "" {
+		log.Warn("upstream trust store is not configured, upstream signature is checked against its own certificate only")
+
+		return signerSvc, nil
+	}
+
+	upstreamVerifier, err := signer.NewUpstreamVerifier(log.With("component", "upstream-verifier"), cfg.Source.TrustStorePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot initialize upstream signature verifier: %w", err)
+	}
+
+	return upstreamVerifier, nil
+}
+
+func newPatchers(log *zap.SugaredLogger, cfg config.AppConfig) []types.Patcher {
+	patchers := []types.Patcher{
+		patcher.NewPatcher(log.With("component", "patcher"), cfg.Patch),
+	}
+
+	if cfg.Patch.CheckAvailability {
+		patchers = append(patchers, patcher.NewMirrorFallbackPatcher(log.With("component", "mirror-fallback-patcher"), cfg.Patch))
+	}
+
+	return patchers
+}
@@ -0,0 +1,145 @@
+package app
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/certgen"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+)
+
+const (
+	rootCAsDir = "update-center-rootCAs"
+	// javaTrustStoreSuffix follows the name of the generated truststore, so it never replaces the base one
+	javaTrustStoreSuffix = "-cacerts"
+)
+
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), perm); err != nil {
+		return fmt.Errorf("cannot write %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func runGenCert(log *zap.SugaredLogger, cfg config.GenCertCommand) error {
+	opts := certgen.Options{
+		CommonName: cfg.CommonName,
+		DNSNames:   cfg.DNSNames,
+		Validity:   time.Duration(cfg.Days) * 24 * time.Hour,
+	}
+
+	for _, s := range cfg.IPs {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return fmt.Errorf("invalid IP address %q", s)
+		}
+
+		opts.IPAddresses = append(opts.IPAddresses, ip)
+	}
+
+	keyPath := filepath.Join(cfg.OutputDir, cfg.Name+".key")
+	trustStorePath := filepath.Join(cfg.OutputDir, cfg.Name+javaTrustStoreSuffix)
+
+	if cfg.BaseTrustStorePath != "" && filepath.Clean(cfg.BaseTrustStorePath) == trustStorePath {
+		return fmt.Errorf("base truststore %s would be replaced by the generated one, pass another --name", cfg.BaseTrustStorePath)
+	}
+
+	if _, err := os.Stat(keyPath); err == nil && !cfg.Force {
+		return fmt.Errorf("%s already exists, use --force to replace it", keyPath)
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("cannot check %s: %w", keyPath, err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(cfg.OutputDir, rootCAsDir), 0o750); err != nil {
+		return fmt.Errorf("cannot create output directory: %w", err)
+	}
+
+	key, err := certgen.GenerateKey(cfg.KeySize)
+	if err != nil {
+		return err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("cannot marshal private key: %w", err)
+	}
+
+	if err := writePEM(keyPath, "PRIVATE KEY", keyDER, 0o600); err != nil {
+		return err
+	}
+
+	log.Infof("private key written to %s", keyPath)
+
+	if cfg.CSR {
+		csrDER, err := certgen.CertificateRequest(key, opts)
+		if err != nil {
+			return err
+		}
+
+		csrPath := filepath.Join(cfg.OutputDir, cfg.Name+".csr")
+		if err := writePEM(csrPath, "CERTIFICATE REQUEST", csrDER, 0o644); err != nil {
+			return err
+		}
+
+		log.Infof("certificate signing request written to %s, put the corporate root CA to %s once it is signed", csrPath, rootCAsDir)
+
+		return nil
+	}
+
+	issued, err := certgen.Issue(key, opts, time.Now())
+	if err != nil {
+		return err
+	}
+
+	root, err := x509.ParseCertificate(issued.Root)
+	if err != nil {
+		return fmt.Errorf("cannot parse generated root CA certificate: %w", err)
+	}
+
+	for _, c := range []struct {
+		path string
+		der  []byte
+	}{
+		{path: filepath.Join(cfg.OutputDir, cfg.Name+".crt"), der: issued.Certificate},
+		{path: filepath.Join(cfg.OutputDir, cfg.Name+"-ca.crt"), der: issued.Root},
+		{path: filepath.Join(cfg.OutputDir, rootCAsDir, cfg.Name+".crt"), der: issued.Root},
+	} {
+		if err := writePEM(c.path, "CERTIFICATE", c.der, 0o644); err != nil {
+			return err
+		}
+
+		log.Infof("certificate written to %s", c.path)
+	}
+
+	log.Infof("pass %s.crt as the certificate and %s-ca.crt as the CA certificate to the signer", cfg.Name, cfg.Name)
+
+	var base []byte
+
+	if cfg.BaseTrustStorePath != "" {
+		if base, err = os.ReadFile(cfg.BaseTrustStorePath); err != nil {
+			return fmt.Errorf("cannot read base truststore: %w", err)
+		}
+	}
+
+	trustStore, err := certgen.JavaTrustStore(base, cfg.TrustStorePassword, cfg.Name, root)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(trustStorePath, trustStore, 0o644); err != nil { //nolint:gosec
+		return fmt.Errorf("cannot write %s: %w", trustStorePath, err)
+	}
+
+	log.Infof("Java truststore written to %s", trustStorePath)
+
+	return nil
+}
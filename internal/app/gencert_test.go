@@ -0,0 +1,133 @@
+package app
+
+import (
+	"bytes"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/certgen"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/signer"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/keystore"
+)
+
+func TestGenCert(t *testing.T) {
+	log := zap.NewNop().Sugar()
+	dir := t.TempDir()
+
+	// the truststore is extended with the generated root
+	baseKey, err := certgen.GenerateKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base, err := certgen.Issue(baseKey, certgen.Options{CommonName: "Base", Validity: time.Hour}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseRoot, err := x509.ParseCertificate(base.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseTrustStore, err := certgen.JavaTrustStore(nil, "changeit", "base", baseRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseTrustStorePath := filepath.Join(dir, "cacerts")
+	if err := os.WriteFile(baseTrustStorePath, baseTrustStore, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.GenCertCommand{
+		OutputDir:          filepath.Join(dir, "cert"),
+		Name:               "uc",
+		CommonName:         "Test Update Center",
+		DNSNames:           []string{"resigner.local"},
+		KeySize:            2048,
+		Days:               1,
+		BaseTrustStorePath: baseTrustStorePath,
+		TrustStorePassword: "changeit",
+	}
+
+	if err := runGenCert(log, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	path := func(name string) string {
+		return filepath.Join(cfg.OutputDir, name)
+	}
+
+	s, err := signer.NewSignerService(log, config.SignerConfig{
+		CertificatePath: path("uc.crt"),
+		KeyPath:         path("uc.key"),
+		CAPath:          path("uc-ca.crt"),
+	})
+	if err != nil {
+		t.Fatalf("generated signing material is not accepted: %v", err)
+	}
+
+	rootPEM, err := os.ReadFile(path(filepath.Join(rootCAsDir, "uc.crt")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if roots := s.RootCertificates(); len(roots) != 1 || roots[0].Subject.CommonName != "Test Update Center Root CA" {
+		t.Fatalf("signer roots %v", roots)
+	}
+
+	if caPEM, _ := os.ReadFile(path("uc-ca.crt")); !bytes.Equal(caPEM, rootPEM) {
+		t.Fatal("update-center-rootCAs holds another certificate than the root CA")
+	}
+
+	trustStore, err := os.ReadFile(path("uc" + javaTrustStoreSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks, err := keystore.Decode(trustStore, "changeit")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ks.TrustedCertificates) != 2 || !ks.TrustedCertificates["uc"].Certificate.Equal(s.RootCertificates()[0]) {
+		t.Fatalf("unexpected truststore entries %v", ks.TrustedCertificates)
+	}
+
+	key, err := os.ReadFile(path("uc.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runGenCert(log, cfg); err == nil {
+		t.Fatal("existing key replaced without --force")
+	}
+
+	if replaced, _ := os.ReadFile(path("uc.key")); !bytes.Equal(replaced, key) {
+		t.Fatal("existing key modified")
+	}
+
+	cfg.Force = true
+
+	if err := runGenCert(log, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if replaced, _ := os.ReadFile(path("uc.key")); bytes.Equal(replaced, key) {
+		t.Fatal("key not replaced with --force")
+	}
+
+	// generating again does not stack the anchors onto the generated truststore
+	cfg.BaseTrustStorePath = path("uc" + javaTrustStoreSuffix)
+
+	if err := runGenCert(log, cfg); err == nil {
+		t.Fatal("base truststore replaced by the generated one")
+	}
+}
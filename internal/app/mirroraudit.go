@@ -0,0 +1,59 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/mirror"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/sourcefileproviders"
+)
+
+func runMirrorAudit(ctx context.Context, log *zap.SugaredLogger, cfg config.AppConfig, sourceFileProvider sourcefileproviders.Provider) error {
+	juc := jenkins.NewJenkinsUpdateCenter(log.With("component", "juc"), cfg, sourceFileProvider, nil, nil, newPatchers(log, cfg))
+
+	_, signedJSON, err := juc.GetOriginal(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := juc.Patch(ctx, signedJSON); err != nil {
+		return err
+	}
+
+	auditor := mirror.NewAuditor(log.With("component", "mirror-audit"), cfg.MirrorAudit, cfg.Patch.NewDownloadURL)
+
+	report := auditor.Audit(ctx, signedJSON.GetUnsigned())
+
+	var w io.Writer = os.Stdout
+
+	if cfg.AuditMirror.OutputPath != "" {
+		f, err := os.Create(cfg.AuditMirror.OutputPath)
+		if err != nil {
+			return fmt.Errorf("failed to create file %s: %w", cfg.AuditMirror.OutputPath, err)
+		}
+		defer f.Close()
+
+		w = f
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(report); err != nil {
+		return fmt.Errorf("cannot write mirror audit report: %w", err)
+	}
+
+	if report.HasProblems() {
+		return fmt.Errorf("mirror audit found %d missing, %d mismatched and %d failed artifacts",
+			report.Summary.Missing, report.Summary.Mismatched, report.Summary.Errors)
+	}
+
+	return nil
+}
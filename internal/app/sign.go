@@ -0,0 +1,46 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/signer"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/sourcefileproviders"
+)
+
+func runSign(ctx context.Context, log *zap.SugaredLogger, cfg config.AppConfig, sourceFileProvider sourcefileproviders.Provider) error {
+	signerSvc, err := signer.NewSignerService(log.With("component", "signer"), cfg.Signer)
+	if err != nil {
+		return fmt.Errorf("cannot initialize signer: %w", err)
+	}
+
+	defer func() {
+		if err := signerSvc.Close(); err != nil {
+			log.Warnf("cannot close signer: %v", err)
+		}
+	}()
+
+	upstreamVerifier, err := newUpstreamVerifier(log, cfg, signerSvc)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(cfg.Sign.OutputDir, 0o750); err != nil {
+		return fmt.Errorf("cannot create output directory: %w", err)
+	}
+
+	juc := jenkins.NewJenkinsUpdateCenter(log.With("component", "juc"), cfg, sourceFileProvider, upstreamVerifier, signerSvc, newPatchers(log, cfg))
+
+	if err := juc.SignOnce(ctx, cfg.Sign.OutputDir); err != nil {
+		return fmt.Errorf("cannot sign update center: %w", err)
+	}
+
+	log.Infof("signed update center written to %s", cfg.Sign.OutputDir)
+
+	return nil
+}
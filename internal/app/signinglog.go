@@ -0,0 +1,51 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/signinglog"
+)
+
+func runSigningLog(log *zap.SugaredLogger, cfg config.AppConfig) error {
+	f, err := os.Open(cfg.Signer.LogPath)
+	if err != nil {
+		return fmt.Errorf("cannot open signing log: %w", err)
+	}
+	defer f.Close()
+
+	if cfg.Command == config.CommandSigningLogVerify {
+		count, last, err := signinglog.Verify(f)
+		if err != nil {
+			return fmt.Errorf("signing log verification failed: %w", err)
+		}
+
+		log.Infof("signing log is intact: %d entries, last entry %d at %s with hash %s", count, last.Seq, last.Time, last.Hash)
+
+		return nil
+	}
+
+	entries, err := signinglog.Lookup(f, cfg.SigningLog.Lookup.Args.Digest)
+	if err != nil {
+		return fmt.Errorf("cannot search signing log: %w", err)
+	}
+
+	if len(entries) == 0 {
+		return fmt.Errorf("no signatures found for digest %s", cfg.SigningLog.Lookup.Args.Digest)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return fmt.Errorf("cannot write signing log entry: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package app
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/signer"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/verifier"
+)
+
+func readUpdateSiteFile(ctx context.Context, source string, timeout time.Duration) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(source) //nolint:gosec
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot download %s: %w", source, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot download %s: unexpected status %s", source, resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+func runVerify(ctx context.Context, log *zap.SugaredLogger, cfg config.AppConfig) error {
+	certs, err := signer.LoadTrustStore(cfg.Verify.RootCAsPath)
+	if err != nil {
+		return err
+	}
+
+	roots := x509.NewCertPool()
+	for _, cert := range certs {
+		roots.AddCert(cert)
+	}
+
+	data, err := readUpdateSiteFile(ctx, cfg.Verify.Args.Source, cfg.GetUpdateJSONBodyTimeout)
+	if err != nil {
+		return fmt.Errorf("cannot read update site file: %w", err)
+	}
+
+	report := verifier.Verify(data, roots, time.Now())
+
+	for _, step := range report.Steps {
+		status, detail := "ok", step.Detail
+
+		switch {
+		case step.Err != nil:
+			status, detail = "FAIL", step.Err.Error()
+		case step.Skipped:
+			status = "skip"
+		}
+
+		fmt.Fprintf(os.Stdout, "%-4s  %-18s %s\n", status, step.Name, detail)
+	}
+
+	if !report.OK() {
+		return fmt.Errorf("%s would be rejected by Jenkins", cfg.Verify.Args.Source)
+	}
+
+	log.Infof("%s signature is valid", cfg.Verify.Args.Source)
+
+	return nil
+}
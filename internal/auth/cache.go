@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// CredentialCache remembers the verified credentials for a short time, so bcrypt is not run on every request,
+// the credentials are kept as HMACs under a key generated at start
+type CredentialCache struct {
+	key        []byte
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu       sync.Mutex
+	verified map[[sha256.Size]byte]time.Time
+}
+
+func NewCredentialCache(ttl time.Duration, maxEntries int) *CredentialCache {
+	key := make([]byte, sha256.Size)
+	_, _ = rand.Read(key)
+
+	return &CredentialCache{
+		key:        key,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		verified:   map[[sha256.Size]byte]time.Time{},
+	}
+}
+
+func (c *CredentialCache) sum(user, password string) [sha256.Size]byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(user))
+	mac.Write([]byte{0})
+	mac.Write([]byte(password))
+
+	var sum [sha256.Size]byte
+	copy(sum[:], mac.Sum(nil))
+
+	return sum
+}
+
+// Verify returns the cached result or the verify one, only the successful checks are cached
+func (c *CredentialCache) Verify(user, password string, verify func(user, password string) bool) bool {
+	sum := c.sum(user, password)
+	now := c.now()
+
+	c.mu.Lock()
+	expires, ok := c.verified[sum]
+	c.mu.Unlock()
+
+	if ok && now.Before(expires) {
+		return true
+	}
+
+	if !verify(user, password) {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.verified) >= c.maxEntries {
+		for k, expires := range c.verified {
+			if !now.Before(expires) {
+				delete(c.verified, k)
+			}
+		}
+	}
+
+	// a full cache of live entries starts over rather than grows
+	if len(c.verified) >= c.maxEntries {
+		clear(c.verified)
+	}
+
+	c.verified[sum] = now.Add(c.ttl)
+
+	return true
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const shaPrefix = "{SHA}"
+
+// unknownUserHash is checked for the unknown users, so they take as long to reject as the known ones
+var unknownUserHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte(rand.Text()), bcrypt.DefaultCost)
+
+	return hash
+})
+
+// Htpasswd maps the user names to their password hashes
+type Htpasswd map[string]string
+
+// LoadHtpasswd reads an Apache htpasswd file, only bcrypt (htpasswd -B) and SHA-1 (htpasswd -s) hashes are supported
+func LoadHtpasswd(path string) (Htpasswd, error) {
+	f, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		users   = Htpasswd{}
+		scanner = bufio.NewScanner(f)
+		lineNo  int
+	)
+
+	for scanner.Scan() {
+		lineNo++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" || hash == "" {
+			return nil, fmt.Errorf("line %d: user:hash expected", lineNo)
+		}
+
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil && !strings.HasPrefix(hash, shaPrefix) {
+			return nil, fmt.Errorf("line %d: password hash of %q is neither bcrypt nor SHA-1 one", lineNo, user)
+		}
+
+		if _, exists := users[user]; exists {
+			return nil, fmt.Errorf("line %d: user %q is already defined", lineNo, user)
+		}
+
+		users[user] = hash
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(users) == 0 {
+		return nil, fmt.Errorf("no users found in %s", path)
+	}
+
+	return users, nil
+}
+
+// Verify checks the password of the user
+func (h Htpasswd) Verify(user, password string) bool {
+	hash, ok := h[user]
+	if !ok {
+		_ = bcrypt.CompareHashAndPassword(unknownUserHash(), []byte(password))
+
+		return false
+	}
+
+	if sha, ok := strings.CutPrefix(hash, shaPrefix); ok {
+		sum := sha1.Sum([]byte(password)) //nolint:gosec
+
+		return subtle.ConstantTimeCompare([]byte(sha), []byte(base64.StdEncoding.EncodeToString(sum[:]))) == 1
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
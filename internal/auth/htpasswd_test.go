@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHtpasswd(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "htpasswd")
+
+	// "password" hashed by htpasswd -s
+	content := "# controllers\nci:" + string(hash) + "\nqa:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := LoadHtpasswd(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		user, password string
+		ok             bool
+	}{
+		{"ci", "s3cret", true},
+		{"ci", "password", false},
+		{"qa", "password", true},
+		{"qa", "s3cret", false},
+		{"nobody", "s3cret", false},
+	} {
+		if users.Verify(tt.user, tt.password) != tt.ok {
+			t.Fatalf("%s:%s verification is not %t", tt.user, tt.password, tt.ok)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("ops:$apr1$abc$def\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadHtpasswd(path); err == nil {
+		t.Fatal("MD5 hash accepted")
+	}
+}
+
+func TestCredentialCache(t *testing.T) {
+	var (
+		calls int
+		now   = time.Now()
+		c     = NewCredentialCache(time.Minute, 2)
+	)
+
+	c.now = func() time.Time { return now }
+
+	verify := func(_, password string) bool {
+		calls++
+
+		return password == "s3cret"
+	}
+
+	for _, tt := range []struct {
+		user, password string
+		ok             bool
+		calls          int
+	}{
+		{"ci", "s3cret", true, 1},
+		{"ci", "s3cret", true, 1},
+		{"ci", "wrong", false, 2},
+		{"ci", "wrong", false, 3},
+		{"qa", "s3cret", true, 4},
+		{"ops", "s3cret", true, 5},
+	} {
+		if c.Verify(tt.user, tt.password, verify) != tt.ok {
+			t.Fatalf("%s:%s verification is not %t", tt.user, tt.password, tt.ok)
+		}
+
+		if calls != tt.calls {
+			t.Fatalf("%s:%s verified %d times, want %d", tt.user, tt.password, calls, tt.calls)
+		}
+	}
+
+	if len(c.verified) > 2 {
+		t.Fatalf("%d credentials cached over the limit", len(c.verified))
+	}
+
+	now = now.Add(time.Minute)
+
+	if c.Verify("ops", "s3cret", verify); calls != 6 {
+		t.Fatal("expired credentials are not verified again")
+	}
+}
@@ -0,0 +1,77 @@
+// Package auth authenticates API callers by the bearer tokens listed in a file
+package auth
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Tokens maps the SHA-256 of the tokens to the caller names
+type Tokens map[[sha256.Size]byte]string
+
+// LoadTokens reads caller:token lines skipping the empty ones and # comments
+func LoadTokens(path string) (Tokens, error) {
+	f, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		callers = Tokens{}
+		scanner = bufio.NewScanner(f)
+		lineNo  int
+	)
+
+	for scanner.Scan() {
+		lineNo++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		caller, token, ok := strings.Cut(line, ":")
+		if caller, token = strings.TrimSpace(caller), strings.TrimSpace(token); !ok || caller == "" || token == "" {
+			return nil, fmt.Errorf("line %d: caller:token expected", lineNo)
+		}
+
+		key := sha256.Sum256([]byte(token))
+		if other, exists := callers[key]; exists {
+			return nil, fmt.Errorf("line %d: token of %q is already used by %q", lineNo, caller, other)
+		}
+
+		callers[key] = caller
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(callers) == 0 {
+		return nil, fmt.Errorf("no tokens found in %s", path)
+	}
+
+	return callers, nil
+}
+
+// Authenticate returns the caller owning the bearer token of the request
+func (t Tokens) Authenticate(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return "", false
+	}
+
+	return t.Lookup(token)
+}
+
+// Lookup returns the caller owning the token
+func (t Tokens) Lookup(token string) (string, bool) {
+	caller, ok := t[sha256.Sum256([]byte(strings.TrimSpace(token)))]
+
+	return caller, ok
+}
@@ -0,0 +1,127 @@
+// Package certgen creates the update center signing key with a certificate issued by its own root CA or a CSR for
+// a corporate CA
+package certgen
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+)
+
+// KeyUsage is the signing certificate key usage, Jenkins requires digital signatures only
+const KeyUsage = x509.KeyUsageDigitalSignature
+
+type Options struct {
+	CommonName  string
+	DNSNames    []string
+	IPAddresses []net.IP
+	Validity    time.Duration
+}
+
+func GenerateKey(bits int) (*rsa.PrivateKey, error) {
+	if bits < 2048 {
+		return nil, fmt.Errorf("RSA key size %d is too small, 2048 bits at least are required", bits)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate RSA key: %w", err)
+	}
+
+	return key, nil
+}
+
+// Issued is a signing certificate and the root CA it is issued by, both DER encoded
+type Issued struct {
+	Certificate []byte
+	Root        []byte
+}
+
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate serial number: %w", err)
+	}
+
+	return serial, nil
+}
+
+// Issue creates a root CA and issues the signing certificate for the key with it. The root key is of the same size
+// and is discarded once the certificate is issued, so the root cannot issue anything else
+func Issue(key *rsa.PrivateKey, opts Options, now time.Time) (Issued, error) {
+	rootKey, err := GenerateKey(key.N.BitLen())
+	if err != nil {
+		return Issued{}, err
+	}
+
+	rootSerial, err := randomSerial()
+	if err != nil {
+		return Issued{}, err
+	}
+
+	root := &x509.Certificate{
+		SerialNumber:          rootSerial,
+		Subject:               pkix.Name{CommonName: opts.CommonName + " Root CA"},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(opts.Validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+		SignatureAlgorithm:    x509.SHA256WithRSA,
+	}
+
+	rootDER, err := x509.CreateCertificate(rand.Reader, root, root, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		return Issued{}, fmt.Errorf("cannot create root CA certificate: %w", err)
+	}
+
+	if root, err = x509.ParseCertificate(rootDER); err != nil {
+		return Issued{}, fmt.Errorf("cannot parse root CA certificate: %w", err)
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return Issued{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: opts.CommonName},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(opts.Validity),
+		KeyUsage:              KeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+		DNSNames:              opts.DNSNames,
+		IPAddresses:           opts.IPAddresses,
+		SignatureAlgorithm:    x509.SHA256WithRSA,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, root, &key.PublicKey, rootKey)
+	if err != nil {
+		return Issued{}, fmt.Errorf("cannot create certificate: %w", err)
+	}
+
+	return Issued{Certificate: der, Root: rootDER}, nil
+}
+
+// CertificateRequest creates the DER encoded CSR to be signed by a corporate CA
+func CertificateRequest(key *rsa.PrivateKey, opts Options) ([]byte, error) {
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:            pkix.Name{CommonName: opts.CommonName},
+		DNSNames:           opts.DNSNames,
+		IPAddresses:        opts.IPAddresses,
+		SignatureAlgorithm: x509.SHA256WithRSA,
+	}, key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create certificate request: %w", err)
+	}
+
+	return der, nil
+}
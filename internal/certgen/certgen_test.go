@@ -0,0 +1,107 @@
+package certgen
+
+import (
+	"crypto/x509"
+	"net"
+	"testing"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/signer"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/keystore"
+)
+
+func TestIssue(t *testing.T) {
+	if _, err := GenerateKey(1024); err == nil {
+		t.Fatal("1024 bits key generated")
+	}
+
+	key, err := GenerateKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := Options{
+		CommonName:  "YourJenkinsUpdateCenter",
+		DNSNames:    []string{"update-json-resigner"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		Validity:    365 * 24 * time.Hour,
+	}
+
+	issued, err := Issue(key, opts, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(issued.Certificate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := x509.ParseCertificate(issued.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	if err := signer.VerifyCertificateChain([]*x509.Certificate{cert}, roots, time.Now()); err != nil {
+		t.Fatalf("generated certificate is not accepted with its root: %v", err)
+	}
+
+	if cert.IsCA || cert.KeyUsage != x509.KeyUsageDigitalSignature || cert.DNSNames[0] != "update-json-resigner" {
+		t.Fatalf("unexpected certificate extensions: %+v", cert)
+	}
+
+	if !root.IsCA || root.KeyUsage&x509.KeyUsageCertSign == 0 || cert.CheckSignatureFrom(root) != nil {
+		t.Fatalf("certificate is not issued by the root CA %q", root.Subject)
+	}
+
+	csrDER, err := CertificateRequest(key, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := csr.CheckSignature(); err != nil || csr.Subject.CommonName != opts.CommonName {
+		t.Fatalf("unexpected certificate request %q: %v", csr.Subject, err)
+	}
+
+	pkcs12Base, err := pkcs12.Modern.EncodeTrustStore([]*x509.Certificate{cert}, "changeit")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, base := range map[string]struct {
+		data    []byte
+		entries int
+	}{
+		"empty":   {nil, 1},
+		"PKCS#12": {pkcs12Base, 2},
+	} {
+		data, err := JavaTrustStore(base.data, "changeit", "Your-Update-Center", cert)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// generating again replaces the certificate
+		if data, err = JavaTrustStore(data, "changeit", "your-update-center", cert); err != nil {
+			t.Fatal(err)
+		}
+
+		ks, err := keystore.Decode(data, "changeit")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := ks.TrustedCertificates["your-update-center"]; !ok || len(ks.TrustedCertificates) != base.entries {
+			t.Fatalf("%s base: unexpected truststore entries %v", name, ks.TrustedCertificates)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package certgen
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/keystore"
+)
+
+// JavaTrustStore puts the certificate under the alias into the base JKS or PKCS#12 truststore, e.g. the JDK cacerts, or to an empty one
+// and returns it JKS encoded
+func JavaTrustStore(base []byte, password, alias string, cert *x509.Certificate) ([]byte, error) {
+	ks := keystore.New()
+
+	switch {
+	case len(base) == 0:
+	case keystore.IsKeyStore(base):
+		var err error
+		if ks, err = keystore.Decode(base, password); err != nil {
+			return nil, fmt.Errorf("cannot decode base truststore: %w", err)
+		}
+	default:
+		certs, err := pkcs12.DecodeTrustStore(base, password)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode base truststore: %w", err)
+		}
+
+		// PKCS#12 friendly names are not exposed, the aliases are derived from the subjects
+		for _, c := range certs {
+			ks.SetTrustedCertificate(uniqueAlias(ks, c.Subject.CommonName), c)
+		}
+	}
+
+	// a certificate generated before under the same alias is replaced
+	ks.SetTrustedCertificate(strings.ToLower(alias), cert)
+
+	var buf bytes.Buffer
+	if err := ks.Encode(&buf, password); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// uniqueAlias lowercases the name the way keytool does and suffixes it when already taken
+func uniqueAlias(ks *keystore.KeyStore, name string) string {
+	name = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), " ", "_"))
+	if name == "" {
+		name = "cert"
+	}
+
+	alias := name
+
+	for i := 2; ; i++ {
+		_, trusted := ks.TrustedCertificates[alias]
+		_, private := ks.PrivateKeys[alias]
+
+		if !trusted && !private {
+			return alias
+		}
+
+		alias = fmt.Sprintf("%s-%d", name, i)
+	}
+}
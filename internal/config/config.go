@@ -2,39 +2,231 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/jessevdk/go-flags"
 )
 
+const (
+	CommandAuditMirror      = "audit-mirror"
+	CommandSigningLogVerify = "signing-log verify"
+	CommandSigningLogLookup = "signing-log lookup"
+	CommandVerify           = "verify"
+	CommandSign             = "sign"
+	CommandGenCert          = "gen-cert"
+
+	SignerBackendFile    = "file"
+	SignerBackendPKCS11  = "pkcs11"
+	SignerBackendCommand = "command"
+
+	TracingExporterNone     = "none"
+	TracingExporterOTLPGRPC = "otlp-grpc"
+	TracingExporterOTLPHTTP = "otlp-http"
+
+	TLSClientAuthNone     = "none"
+	TLSClientAuthOptional = "optional"
+	TLSClientAuthRequire  = "require"
+
+	DownloadModeProxy    = "proxy"
+	DownloadModeRedirect = "redirect"
+)
+
 type ServerConfig struct {
 	ListenAddr string `long:"listen-addr" env:"LISTEN_ADDR" default:""`
 	ListenPort int    `long:"listen-port" env:"LISTEN_PORT" default:"8282"`
 
+	Listen          []string `long:"listen" env:"LISTEN" env-delim:"," description:"public listener as http://[host]:port, https://[host]:port, unix:///path or systemd://[name], unix+https:// and systemd+https:// serve TLS, replaces --listen-addr and --listen-port"`
+	UnixSocketMode  string   `long:"unix-socket-mode" env:"UNIX_SOCKET_MODE" default:"0660" description:"octal permissions of the unix sockets"`
+	RedirectToHTTPS bool     `long:"redirect-to-https" env:"REDIRECT_TO_HTTPS" description:"redirect the requests to the plain HTTP TCP listeners to the HTTPS public URL or the first TCP HTTPS listener, except the health checks"`
+
 	TLSCertPath string `long:"tlscert" env:"TLS_CERT_PATH" default:""`
 	TLSKeyPath  string `long:"tlskey" env:"TLS_KEY_PATH" default:""`
+
+	TLSMinVersion          string        `long:"tls-min-version" env:"TLS_MIN_VERSION" default:"1.2" choice:"1.2" choice:"1.3" description:"minimal TLS version of both listeners"`
+	TLSCipherSuites        []string      `long:"tls-cipher-suite" env:"TLS_CIPHER_SUITES" env-delim:"," description:"TLS 1.2 cipher suites of both listeners by their IANA names, the Go defaults when not set"`
+	TLSClientCAPath        string        `long:"tls-client-ca" env:"TLS_CLIENT_CA_PATH" description:"PEM bundle of the CAs the client certificates are verified against"`
+	TLSClientAuth          string        `long:"tls-client-auth" env:"TLS_CLIENT_AUTH" default:"none" choice:"none" choice:"optional" choice:"require" description:"client certificate authentication of the public listener"`
+	TLSReloadCheckInterval time.Duration `long:"tls-reload-check-interval" env:"TLS_RELOAD_CHECK_INTERVAL" default:"30s" description:"TLS certificate and key files change check interval, 0 disables the reload"`
+
+	FeedTimeout         time.Duration `long:"feed-timeout" env:"FEED_TIMEOUT" default:"15s" description:"total timeout of update-center.json requests"`
+	ArtifactIdleTimeout time.Duration `long:"artifact-idle-timeout" env:"ARTIFACT_IDLE_TIMEOUT" default:"60s" description:"proxied artifact download is aborted when the mirror sends no data during this period, 0 disables the timeout"`
+
+	PublicURL    string `long:"public-url" env:"PUBLIC_URL" description:"URL Jenkins controllers reach the service at, used in the generated Jenkins configuration, derived from the request when empty"`
+	UpdateSiteID string `long:"update-site-id" env:"UPDATE_SITE_ID" default:"default" description:"update site id in the generated Jenkins configuration"`
+
+	DownloadMode string `long:"download-mode" env:"DOWNLOAD_MODE" default:"proxy" choice:"proxy" choice:"redirect" description:"proxy artifact downloads to the real mirror or redirect clients to one of the redirect mirrors"`
+
+	Admin          AdminServerConfig
+	Readiness      ReadinessConfig
+	Access         AccessConfig
+	MirrorProfiles MirrorProfilesConfig
+}
+
+// MirrorProfilesConfig points the downloads of the selected clients to their own mirrors, each profile is served
+// a variant of the feed patched for its download URL and signed
+type MirrorProfilesConfig struct {
+	Profiles    []string `long:"mirror-profile" env:"MIRROR_PROFILES" env-delim:";" description:"mirror profile as NAME=URL[,subnet=CIDR...][,host=HOST...], URL request-host derives the download URL from the request to one of the hosts listed"`
+	QueryParam  string   `long:"mirror-profile-param" env:"MIRROR_PROFILE_PARAM" default:"mirror" description:"feed URL query parameter selecting the mirror profile by name"`
+	MaxVariants int      `long:"mirror-profile-max-variants" env:"MIRROR_PROFILE_MAX_VARIANTS" default:"32" description:"signed feed variants kept per generation, the default feed is served beyond it"`
+}
+
+// AccessConfig restricts the feed and the artifact downloads, they are public when nothing is configured
+type AccessConfig struct {
+	TokensPath     string   `long:"access-tokens" env:"ACCESS_TOKENS_PATH" description:"file of team:token lines, a token is accepted as the bearer token, the basic auth password or the token query parameter"`
+	HtpasswdPath   string   `long:"access-htpasswd" env:"ACCESS_HTPASSWD_PATH" description:"htpasswd file with bcrypt or SHA-1 password hashes for basic auth"`
+	AllowCIDRs     []string `long:"access-allow-cidr" env:"ACCESS_ALLOW_CIDRS" env-delim:"," description:"client networks allowed without credentials"`
+	ClientCerts    []string `long:"access-client-cert" env:"ACCESS_CLIENT_CERTS" env-delim:"," description:"common names or DNS, email or URI SANs of the client certificates allowed, any certificate verified against the client CA is allowed when empty"`
+	TrustedProxies []string `long:"access-trusted-proxy" env:"ACCESS_TRUSTED_PROXIES" env-delim:"," description:"reverse proxy networks, or unix for the unix socket peers, trusted to report the client address in X-Forwarded-For and the scheme in X-Forwarded-Proto"`
+}
+
+// ReadinessConfig holds the optional /readyz checks, the first generation is always required
+type ReadinessConfig struct {
+	MaxFeedAge              time.Duration `long:"readiness-max-feed-age" env:"READINESS_MAX_FEED_AGE" default:"0s" description:"served generation age making the service not ready, 0 disables the check"`
+	MaxRefreshFailures      int           `long:"readiness-max-refresh-failures" env:"READINESS_MAX_REFRESH_FAILURES" default:"0" description:"consecutive refresh failures making the service not ready, 0 disables the check"`
+	RequireValidCertificate bool          `long:"readiness-require-valid-certificate" env:"READINESS_REQUIRE_VALID_CERTIFICATE" description:"the service is not ready while the signing certificate is expired or not yet valid"`
+}
+
+// AdminServerConfig is the listener of the operator endpoints: pprof, metrics, status, admin and signing API
+type AdminServerConfig struct {
+	ListenAddr string `long:"admin-listen-addr" env:"ADMIN_LISTEN_ADDR" default:"127.0.0.1" description:"admin listener address, other than a loopback one requires --admin-require-auth"`
+	ListenPort int    `long:"admin-listen-port" env:"ADMIN_LISTEN_PORT" default:"8283" description:"0 disables the admin listener"`
+
+	TLSCertPath string `long:"admin-tlscert" env:"ADMIN_TLS_CERT_PATH" default:""`
+	TLSKeyPath  string `long:"admin-tlskey" env:"ADMIN_TLS_KEY_PATH" default:""`
+
+	TokensPath  string `long:"admin-tokens" env:"ADMIN_TOKENS_PATH" description:"file of caller:token lines allowed to use the admin API, the API is disabled when not set"`
+	RequireAuth bool   `long:"admin-require-auth" env:"ADMIN_REQUIRE_AUTH" description:"require the admin tokens on every admin listener endpoint, not only on the admin API"`
+}
+
+type RedirectConfig struct {
+	Mirrors []string `long:"redirect-mirror" env:"REDIRECT_MIRRORS" env-delim:";" description:"redirect mirror as URL[,weight=N][,subnet=CIDR...], the real mirror URL is used when none is configured"`
+
+	HealthCheckPath     string        `long:"redirect-health-check-path" env:"REDIRECT_HEALTH_CHECK_PATH" default:"/" description:"path relative to the mirror URL requested with HEAD to check its health"`
+	HealthCheckInterval time.Duration `long:"redirect-health-check-interval" env:"REDIRECT_HEALTH_CHECK_INTERVAL" default:"30s"`
+	HealthCheckTimeout  time.Duration `long:"redirect-health-check-timeout" env:"REDIRECT_HEALTH_CHECK_TIMEOUT" default:"5s"`
+	UnhealthyThreshold  int           `long:"redirect-unhealthy-threshold" env:"REDIRECT_UNHEALTHY_THRESHOLD" default:"2" description:"consecutive failed health checks taking a mirror out of rotation"`
 }
 
 type SignerConfig struct {
 	CAPath          string `long:"ca-certificate-path" env:"SIGN_CA_PATH" description:"x509 CA certificates path"`
-	CertificatePath string `long:"certificate-path" env:"SIGN_CERTIFICATE_PATH" description:"x509-certificate path" required:"true"`
-	KeyPath         string `long:"key-path" env:"SIGN_KEY_PATH" description:"private key path" required:"true"`
+	CertificatePath string `long:"certificate-path" env:"SIGN_CERTIFICATE_PATH" description:"x509-certificate path"`
+	KeyPath         string `long:"key-path" env:"SIGN_KEY_PATH" description:"private key path"`
 	KeyPassword     string `long:"private-key-pass" env:"SIGN_KEY_PASSWORD"`
+	KeyPasswordFile string `long:"private-key-pass-file" env:"SIGN_KEY_PASSWORD_FILE" description:"file to read the private key and keystore password from"`
+
+	Backend            string        `long:"signer-backend" env:"SIGN_BACKEND" choice:"file" choice:"pkcs11" choice:"command" default:"file" description:"where the private key is kept, with the pkcs11 and command backends --key-path refers to the key"`
+	PKCS11ModulePath   string        `long:"pkcs11-module" env:"SIGN_PKCS11_MODULE" description:"PKCS#11 library path"`
+	PKCS11TokenLabel   string        `long:"pkcs11-token-label" env:"SIGN_PKCS11_TOKEN_LABEL" description:"PKCS#11 token holding the private key"`
+	SignCommand        string        `long:"sign-command" env:"SIGN_COMMAND" description:"command signing the digest passed on stdin"`
+	SignCommandArgs    []string      `long:"sign-command-arg" env:"SIGN_COMMAND_ARGS" env-delim:" " description:"signing command arguments"`
+	SignCommandTimeout time.Duration `long:"sign-command-timeout" env:"SIGN_COMMAND_TIMEOUT" default:"30s"`
+
+	KeystorePath  string `long:"keystore-path" env:"SIGN_KEYSTORE_PATH" description:"PKCS#12, JKS or JCEKS keystore holding the private key and certificate chain"`
+	KeystoreAlias string `long:"keystore-alias" env:"SIGN_KEYSTORE_ALIAS" description:"JKS/JCEKS private key alias, required when the keystore holds several keys"`
+	KeystorePass  string `long:"keystore-pass" env:"SIGN_KEYSTORE_PASSWORD" description:"JKS/JCEKS keystore password when it differs from the private key one"`
+
+	NextCertificatePath string        `long:"next-certificate-path" env:"SIGN_NEXT_CERTIFICATE_PATH" description:"x509-certificate to switch to at the activation time"`
+	NextKeyPath         string        `long:"next-key-path" env:"SIGN_NEXT_KEY_PATH" description:"private key to switch to at the activation time"`
+	NextKeystorePath    string        `long:"next-keystore-path" env:"SIGN_NEXT_KEYSTORE_PATH" description:"keystore to switch to at the activation time"`
+	NextActivationTime  string        `long:"next-activation-time" env:"SIGN_NEXT_ACTIVATION_TIME" description:"RFC 3339 time to start signing with the next certificate and key at"`
+	ReloadCheckInterval time.Duration `long:"reload-check-interval" env:"SIGN_RELOAD_CHECK_INTERVAL" default:"30s" description:"signing material files change check interval, 0 reloads on SIGHUP only"`
+
+	LogPath string `long:"signing-log" env:"SIGN_LOG_PATH" description:"append-only hash-chained log of every signature made"`
+
+	ExpiryWarnThresholds []time.Duration `long:"certificate-expiry-warn" env:"SIGN_CERTIFICATE_EXPIRY_WARN" env-delim:"," default:"720h" default:"168h" default:"24h" description:"remaining certificate validity periods to warn at"`
+	ExpiryCheckInterval  time.Duration   `long:"certificate-expiry-check-interval" env:"SIGN_CERTIFICATE_EXPIRY_CHECK_INTERVAL" default:"1h"`
+	RefuseExpired        bool            `long:"refuse-expired-certificate" env:"SIGN_REFUSE_EXPIRED_CERTIFICATE" description:"refuse to publish signatures made with an expired certificate"`
 }
 
 type SourceConfig struct {
 	Path string `long:"update-json-path"  env:"UPDATE_JSON_PATH"`
 	URL  string `long:"update-json-url" env:"UPDATE_JSON_URL"`
+
+	TrustStorePath string `long:"upstream-trust-store" env:"UPSTREAM_TRUST_STORE_PATH" description:"PEM bundle or directory laid out like update-center-rootCAs with the upstream signing root CAs"`
 }
 
 type PatchConfig struct {
 	OriginDownloadURL string `long:"origin-download-uri" env:"ORIGIN_DOWNLOAD_URL" default:"https://updates.jenkins.io/"`
-	NewDownloadURL    string `long:"new-download-uri" env:"NEW_DOWNLOAD_URL" required:"true"`
+	NewDownloadURL    string `long:"new-download-uri" env:"NEW_DOWNLOAD_URL"`
+
+	CheckAvailability       bool          `long:"check-artifact-availability" env:"CHECK_ARTIFACT_AVAILABILITY" description:"check every rewritten artifact on the new download URL and fall back when it is missing"`
+	FallbackDownloadURLs    []string      `long:"fallback-download-uri" env:"FALLBACK_DOWNLOAD_URLS" env-delim:"," description:"ordered fallback mirrors for artifacts missing on the new download URL, upstream is used when none has it"`
+	AvailabilityTimeout     time.Duration `long:"artifact-availability-timeout" env:"ARTIFACT_AVAILABILITY_TIMEOUT" default:"10s"`
+	AvailabilityConcurrency int           `long:"artifact-availability-concurrency" env:"ARTIFACT_AVAILABILITY_CONCURRENCY" default:"16"`
+	FallbackRecheckInterval time.Duration `long:"fallback-recheck-interval" env:"FALLBACK_RECHECK_INTERVAL" default:"5m" description:"minimal interval between re-evaluations of artifacts served from fallbacks"`
+}
+
+type SignAPIConfig struct {
+	TokensPath      string `long:"sign-api-tokens" env:"SIGN_API_TOKENS_PATH" description:"file of caller:token lines allowed to use the signing API, the API is disabled when not set"`
+	MaxDocumentSize int64  `long:"sign-api-max-document-size" env:"SIGN_API_MAX_DOCUMENT_SIZE" default:"67108864" description:"largest document accepted for signing, in bytes"`
+}
+
+type TracingConfig struct {
+	Exporter    string  `long:"tracing-exporter" env:"TRACING_EXPORTER" default:"none" choice:"none" choice:"otlp-grpc" choice:"otlp-http" description:"OpenTelemetry trace exporter"`
+	Endpoint    string  `long:"tracing-endpoint" env:"TRACING_ENDPOINT" description:"collector host:port, the OTEL_EXPORTER_OTLP_* variables apply when empty"`
+	Insecure    bool    `long:"tracing-insecure" env:"TRACING_INSECURE" description:"export traces without TLS"`
+	SampleRatio float64 `long:"tracing-sample-ratio" env:"TRACING_SAMPLE_RATIO" default:"1" description:"share of the traces started by the service which are sampled"`
+}
+
+type MirrorAuditConfig struct {
+	Interval        time.Duration `long:"mirror-audit-interval" env:"MIRROR_AUDIT_INTERVAL" default:"0s" description:"background mirror audit interval, 0 disables the audit worker"`
+	SampleRate      float64       `long:"mirror-audit-sample-rate" env:"MIRROR_AUDIT_SAMPLE_RATE" default:"0.01" description:"share of available artifacts re-hashed against the feed sha256"`
+	Concurrency     int           `long:"mirror-audit-concurrency" env:"MIRROR_AUDIT_CONCURRENCY" default:"8"`
+	Timeout         time.Duration `long:"mirror-audit-timeout" env:"MIRROR_AUDIT_TIMEOUT" default:"15s" description:"HEAD request timeout"`
+	DownloadTimeout time.Duration `long:"mirror-audit-download-timeout" env:"MIRROR_AUDIT_DOWNLOAD_TIMEOUT" default:"10m" description:"sampled artifact download timeout"`
+}
+
+type MirrorAuditCommand struct {
+	OutputPath string `long:"output" description:"write the report to the file instead of stdout"`
+}
+
+type SigningLogCommand struct {
+	Verify struct{}                `command:"verify" description:"check the integrity of the signing log hash chain"`
+	Lookup SigningLogLookupCommand `command:"lookup" description:"find the signatures of a document by its SHA-512 or SHA-1 digest"`
+}
+
+type SigningLogLookupCommand struct {
+	Args struct {
+		Digest string `positional-arg-name:"digest" description:"hex or base64 encoded document digest"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+type SignOnceCommand struct {
+	OutputDir string `long:"output-dir" required:"yes" description:"directory update-center.json, update-center.json.html and update-center.actual.json are written to"`
+}
+
+type GenCertCommand struct {
+	OutputDir  string   `long:"output-dir" default:"./cert" description:"directory the key, the certificate or CSR, the update-center-rootCAs directory and the Java truststore are written to"`
+	Name       string   `long:"name" default:"your-update-center" description:"base name of the key, certificate and CSR files"`
+	CommonName string   `long:"cn" default:"YourJenkinsUpdateCenter" description:"certificate subject common name"`
+	DNSNames   []string `long:"dns" default:"your-update-center" default:"update-json-resigner" default:"host.docker.internal" description:"subject alternative DNS names"`
+	IPs        []string `long:"ip" default:"127.0.0.1" description:"subject alternative IP addresses"`
+	KeySize    int      `long:"key-size" default:"4096" description:"RSA key size"`
+	Days       int      `long:"days" default:"3650" description:"generated certificate and root CA validity"`
+	CSR        bool     `long:"csr" description:"write a certificate signing request for the corporate CA instead of issuing the certificate"`
+	Force      bool     `long:"force" description:"overwrite an existing private key"`
+
+	BaseTrustStorePath string `long:"base-truststore" description:"JKS or PKCS#12 truststore the certificate is added to, e.g. $JAVA_HOME/lib/security/cacerts"`
+	TrustStorePassword string `long:"truststore-password" default:"changeit" description:"base and generated Java truststore password"`
+}
+
+type VerifyCommand struct {
+	RootCAsPath string `long:"root-ca-dir" required:"yes" description:"PEM bundle or directory laid out like ${JENKINS_HOME}/update-center-rootCAs with the trusted root CAs"`
+
+	Args struct {
+		Source string `positional-arg-name:"file" description:"update-center.json, update-center.json.html or update-center.actual.json path or URL"`
+	} `positional-args:"yes" required:"yes"`
 }
 
 type AppConfig struct {
+	// Command is the name of the active sub-command, empty for the server mode
+	Command string
+
 	Dbg bool `long:"debug" env:"DEBUG" description:"debug mode"`
 
 	Source SourceConfig
@@ -45,11 +237,24 @@ type AppConfig struct {
 
 	UpdateJSONCacheTTL time.Duration `long:"cache-ttl" env:"UPDATE_JSON_CACHE_TTL" default:"30m"`
 
-	Signer SignerConfig
-	Patch  PatchConfig
-	Server ServerConfig
+	RefreshInterval time.Duration `long:"refresh-interval" env:"REFRESH_INTERVAL" default:"0s" description:"background refresh interval keeping the served files fresh without feed requests, 0 refreshes on feed requests only"`
+
+	Signer   SignerConfig
+	Patch    PatchConfig
+	Server   ServerConfig
+	Redirect RedirectConfig
+
+	MirrorAudit MirrorAuditConfig
+	SignAPI     SignAPIConfig
+	Tracing     TracingConfig
 
 	DataDirPath string `long:"data-dir" env:"DATA_DIR" default:"/tmp/update-center-data"`
+
+	AuditMirror MirrorAuditCommand `command:"audit-mirror" description:"check that every rewritten artifact URL is available on the mirror and exit"`
+	SigningLog  SigningLogCommand  `command:"signing-log" description:"inspect the signing log"`
+	Sign        SignOnceCommand    `command:"sign" description:"patch and sign the original file once, write the results to a directory and exit"`
+	GenCert     GenCertCommand     `command:"gen-cert" description:"generate the signing key with a certificate issued by its own root CA or a CSR and exit"`
+	Verify      VerifyCommand      `command:"verify" description:"validate the signature of an update site file the way Jenkins does and exit"`
 }
 
 func (cfg AppConfig) validateSource() error {
@@ -64,20 +269,226 @@ func (cfg AppConfig) validateSource() error {
 	return nil
 }
 
+func (cfg AppConfig) validateSigner() error {
+	if cfg.Signer.KeyPassword != "" && cfg.Signer.KeyPasswordFile != "" {
+		return fmt.Errorf("private key password and password file are mutually exclusive")
+	}
+
+	switch cfg.Signer.Backend {
+	case SignerBackendPKCS11:
+		if cfg.Signer.PKCS11ModulePath == "" || cfg.Signer.PKCS11TokenLabel == "" {
+			return fmt.Errorf("PKCS#11 module and token label must be configured")
+		}
+	case SignerBackendCommand:
+		if cfg.Signer.SignCommand == "" {
+			return fmt.Errorf("signing command must be configured")
+		}
+	}
+
+	if cfg.Signer.Backend != SignerBackendFile && (cfg.Signer.KeystorePath != "" || cfg.Signer.NextKeystorePath != "") {
+		return fmt.Errorf("keystores are supported by the file backend only")
+	}
+
+	if cfg.Signer.KeystorePath == "" {
+		if cfg.Signer.CertificatePath == "" {
+			return fmt.Errorf("certificate path or keystore path must be configured")
+		}
+
+		if cfg.Signer.KeyPath == "" && cfg.Signer.Backend != SignerBackendCommand {
+			return fmt.Errorf("private key path must be configured")
+		}
+	} else if cfg.Signer.CertificatePath != "" || cfg.Signer.KeyPath != "" {
+		return fmt.Errorf("keystore path and certificate or private key paths are mutually exclusive")
+	}
+
+	if cfg.Signer.KeystorePass != "" && cfg.Signer.KeystorePath == "" && cfg.Signer.NextKeystorePath == "" {
+		return fmt.Errorf("keystore password requires a keystore")
+	}
+
+	if cfg.Signer.NextCertificatePath == "" && cfg.Signer.NextKeyPath != "" {
+		return fmt.Errorf("next private key requires the next certificate")
+	}
+
+	if cfg.Signer.NextCertificatePath != "" && cfg.Signer.NextKeyPath == "" && cfg.Signer.Backend != SignerBackendCommand {
+		return fmt.Errorf("next certificate and next private key must be configured together")
+	}
+
+	if cfg.Signer.NextKeystorePath != "" && cfg.Signer.NextCertificatePath != "" {
+		return fmt.Errorf("next keystore path and next certificate paths are mutually exclusive")
+	}
+
+	if cfg.Signer.NextCertificatePath != "" || cfg.Signer.NextKeystorePath != "" {
+		if _, err := time.Parse(time.RFC3339, cfg.Signer.NextActivationTime); err != nil {
+			return fmt.Errorf("next activation time must be RFC 3339 formatted: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (cfg AppConfig) validateTLS() error {
+	if (cfg.Server.TLSCertPath == "") != (cfg.Server.TLSKeyPath == "") {
+		return fmt.Errorf("TLS certificate and key must be configured together")
+	}
+
+	if (cfg.Server.Admin.TLSCertPath == "") != (cfg.Server.Admin.TLSKeyPath == "") {
+		return fmt.Errorf("admin TLS certificate and key must be configured together")
+	}
+
+	if cfg.Server.TLSClientAuth == TLSClientAuthNone {
+		if cfg.Server.TLSClientCAPath != "" {
+			return fmt.Errorf("client CA requires client certificate authentication to be enabled")
+		}
+
+		if len(cfg.Server.Access.ClientCerts) > 0 {
+			return fmt.Errorf("allowed client certificates require client certificate authentication to be enabled")
+		}
+
+		return nil
+	}
+
+	if cfg.Server.TLSClientCAPath == "" {
+		return fmt.Errorf("client certificate authentication requires the client CA")
+	}
+
+	if cfg.Server.TLSCertPath == "" {
+		return fmt.Errorf("client certificate authentication requires TLS")
+	}
+
+	return nil
+}
+
+// isLoopback reports whether the listen address accepts local connections only, an empty one listens on all interfaces
+func isLoopback(addr string) bool {
+	if addr == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(addr)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+// publicPorts are the TCP ports of the public listeners, the unparsable --listen ones are reported by the server
+func (cfg ServerConfig) publicPorts() []int {
+	if len(cfg.Listen) == 0 {
+		return []int{cfg.ListenPort}
+	}
+
+	var ports []int
+
+	for _, spec := range cfg.Listen {
+		u, err := url.Parse(strings.TrimSpace(spec))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+
+		if port, err := strconv.Atoi(u.Port()); err == nil {
+			ports = append(ports, port)
+		}
+	}
+
+	return ports
+}
+
+func (cfg AppConfig) validateAdmin() error {
+	if cfg.Server.Admin.RequireAuth && cfg.Server.Admin.TokensPath == "" {
+		return fmt.Errorf("admin tokens must be configured to require authentication")
+	}
+
+	if cfg.Server.Admin.ListenPort != 0 {
+		for _, port := range cfg.Server.publicPorts() {
+			if port == cfg.Server.Admin.ListenPort {
+				return fmt.Errorf("admin listener port must differ from the public ones")
+			}
+		}
+	}
+
+	if cfg.Server.Admin.ListenPort == 0 {
+		if cfg.SignAPI.TokensPath != "" {
+			return fmt.Errorf("signing API is served on the admin listener, which is disabled")
+		}
+
+		return nil
+	}
+
+	if !isLoopback(cfg.Server.Admin.ListenAddr) && !cfg.Server.Admin.RequireAuth {
+		return fmt.Errorf("admin listener on %q is reachable from other hosts, require authentication or listen on a loopback address", cfg.Server.Admin.ListenAddr)
+	}
+
+	return nil
+}
+
+func (cfg AppConfig) validatePatch() error {
+	if cfg.Patch.NewDownloadURL == "" {
+		return fmt.Errorf("new download URL must be configured")
+	}
+
+	return nil
+}
+
 func ParseConfig() (AppConfig, error) {
 	cfg := AppConfig{}
 
-	if _, err := flags.Parse(&cfg); err != nil {
+	parser := flags.NewParser(&cfg, flags.Default)
+	parser.SubcommandsOptional = true
+
+	if _, err := parser.Parse(); err != nil {
 		return AppConfig{}, err
 	}
 
+	for active := parser.Active; active != nil; active = active.Active {
+		cfg.Command = strings.TrimSpace(cfg.Command + " " + active.Name)
+	}
+
+	if cfg.Command == CommandSigningLogVerify || cfg.Command == CommandSigningLogLookup {
+		if cfg.Signer.LogPath == "" {
+			return AppConfig{}, fmt.Errorf("signing log path must be configured")
+		}
+
+		return cfg, nil
+	}
+
+	if cfg.Command == CommandVerify || cfg.Command == CommandGenCert {
+		return cfg, nil
+	}
+
 	cfg.Patch.OriginDownloadURL = strings.TrimSuffix(cfg.Patch.OriginDownloadURL, "/")
 	cfg.Patch.NewDownloadURL = strings.TrimSuffix(cfg.Patch.NewDownloadURL, "/")
 
+	for i := range cfg.Patch.FallbackDownloadURLs {
+		cfg.Patch.FallbackDownloadURLs[i] = strings.TrimSuffix(cfg.Patch.FallbackDownloadURLs[i], "/")
+	}
+
 	if err := cfg.validateSource(); err != nil {
 		return AppConfig{}, fmt.Errorf("invalid source: %w", err)
 	}
 
+	if err := cfg.validatePatch(); err != nil {
+		return AppConfig{}, fmt.Errorf("invalid patch settings: %w", err)
+	}
+
+	if cfg.Command == "" || cfg.Command == CommandSign {
+		if err := cfg.validateSigner(); err != nil {
+			return AppConfig{}, fmt.Errorf("invalid signer settings: %w", err)
+		}
+	}
+
+	if cfg.Command == "" {
+		if err := cfg.validateTLS(); err != nil {
+			return AppConfig{}, fmt.Errorf("invalid TLS settings: %w", err)
+		}
+
+		if err := cfg.validateAdmin(); err != nil {
+			return AppConfig{}, fmt.Errorf("invalid admin listener settings: %w", err)
+		}
+
+		// the feed requests do not wait for the mirror checks, the background refresher makes the new generations
+		if cfg.Patch.CheckAvailability && cfg.RefreshInterval <= 0 {
+			return AppConfig{}, fmt.Errorf("artifact availability checks require the background refresh interval")
+		}
+	}
+
 	if err := os.MkdirAll(cfg.DataDirPath, 0o750); err != nil {
 		return AppConfig{}, fmt.Errorf("failed to create temp directory: %w", err)
 	}
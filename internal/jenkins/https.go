@@ -1,6 +1,7 @@
 package jenkins
 
 const (
-	UpdateCenterDotJSON = "update-center.json"
-	UpdateCenterDotHTML = "update-center.json.html"
+	UpdateCenterDotJSON    = "update-center.json"
+	UpdateCenterDotHTML    = "update-center.json.html"
+	UpdateCenterActualJSON = "update-center.actual.json"
 )
@@ -7,39 +7,78 @@ import (
 	"io"
 	"os"
 	"path"
+	"slices"
 	"sync"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 
 	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
 	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/sourcefileproviders"
 	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/types"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/metrics"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/tracing"
 )
 
 type PatchedFileRefresher interface {
 	RefreshContent(ctx context.Context) error
 }
 
+// RotatableSigner is implemented by the signers able to switch the signing material at runtime
+type RotatableSigner interface {
+	SigningCertificates() []string
+}
+
 var (
 	_ PatchedFileRefresher = (*Service)(nil)
+
+	// servedFiles are the variants of the signed document the server returns to Jenkins
+	servedFiles = []wrappedFile{
+		{UpdateCenterDotJSON, sourcefileproviders.WrappedJSONPPrefix, sourcefileproviders.WrappedJSONPSuffix},
+		{UpdateCenterDotHTML, sourcefileproviders.WrappedHTMLPrefix, sourcefileproviders.WrappedHTMLSuffix},
+	}
+
+	// staticFiles are also published by static update sites
+	staticFiles = append(slices.Clone(servedFiles), wrappedFile{name: UpdateCenterActualJSON})
 )
 
+type wrappedFile struct {
+	name           string
+	prefix, suffix []byte
+}
+
 type Service struct {
 	log                *zap.SugaredLogger
 	cfg                config.AppConfig
 	sourceFileProvider sourcefileproviders.Provider
+	upstreamVerifier   types.SignatureVerifier
 	signer             types.Signer
 	patchers           []types.Patcher
 
 	mu sync.Mutex
 
 	metadata sourcefileproviders.FileMetadata
+
+	patchedMu sync.RWMutex
+	patched   *types.SignedUpdateJSON
+	patchedAt time.Time
+
+	current, previous   *Generation
+	lastError           *RefreshError
+	consecutiveFailures int
+
+	variantsMu      sync.Mutex
+	variants        map[string]*Variant
+	variantsSigning map[string]*variantCall
+	variantsOf      *Generation
 }
 
 func NewJenkinsUpdateCenter(
 	log *zap.SugaredLogger,
 	cfg config.AppConfig,
 	sourceFileProvider sourcefileproviders.Provider,
+	upstreamVerifier types.SignatureVerifier,
 	signer types.Signer,
 	patchers []types.Patcher,
 ) *Service {
@@ -47,6 +86,7 @@ func NewJenkinsUpdateCenter(
 		log:                log,
 		cfg:                cfg,
 		sourceFileProvider: sourceFileProvider,
+		upstreamVerifier:   upstreamVerifier,
 		signer:             signer,
 		patchers:           patchers,
 	}
@@ -81,10 +121,28 @@ func (s *Service) writeDataWithTrailers(w io.Writer, data io.Reader, prefix, suf
 	return nil
 }
 
+// RefreshContent regenerates the served files when the original file changed, it is called on the feed requests,
+// so with the availability checks only the first generation is made here and the rest is left to the background refresher
 func (s *Service) RefreshContent(ctx context.Context) error {
+	if s.cfg.Patch.CheckAvailability && s.GetPatchedUpdateJSON() != nil {
+		if s.isResignDue() {
+			return s.resign(ctx)
+		}
+
+		return nil
+	}
+
+	return s.refresh(ctx)
+}
+
+// refresh regenerates the served files when the original file changed or the fallbacks are due to be checked again
+func (s *Service) refresh(ctx context.Context) error {
 	newMetadata, err := s.sourceFileProvider.GetMetadata(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get JSONP metadata: %w", err)
+		// the failed check is the attempt, so the failures never outnumber the attempts
+		metrics.RefreshAttempts.Inc()
+
+		return s.failed(metrics.StageFetch, fmt.Errorf("failed to get JSONP metadata: %w", err))
 	}
 
 	jsonpFile := path.Join(s.cfg.DataDirPath, UpdateCenterDotJSON)
@@ -97,73 +155,306 @@ func (s *Service) RefreshContent(ctx context.Context) error {
 		s.log.Info("temp file(s) do not exist, force update")
 	}
 
-	if newMetadata == s.metadata && err1 == nil && err2 == nil {
+	if newMetadata == s.metadata && err1 == nil && err2 == nil && !s.isFallbackRecheckDue() {
+		if s.isResignDue() {
+			return s.resign(ctx)
+		}
+
+		s.succeeded()
+
 		s.log.Debugf("original file didn't change: %d bytes, last-modified: %s", newMetadata.Size, newMetadata.LastModified)
 		return nil
 	}
 
 	s.log.Infof("original file changed: %d bytes, last-modified: %s", newMetadata.Size, newMetadata.LastModified)
 
+	return s.regenerate(ctx)
+}
+
+// regenerate fetches, verifies, patches, signs and publishes the original file
+func (s *Service) regenerate(ctx context.Context) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	metrics.RefreshAttempts.Inc()
+
+	fetchedAt := time.Now()
+
 	newMetadata, signedJSON, err := s.GetOriginal(ctx)
 	if err != nil {
+		return s.failed(metrics.StageFetch, err)
+	}
+
+	if err := s.verifyOriginal(ctx, signedJSON); err != nil {
+		return s.failed(metrics.StageVerify, err)
+	}
+
+	original, err := s.keepOriginal(signedJSON)
+	if err != nil {
+		return s.failed(metrics.StagePatch, err)
+	}
+
+	if err := s.patchAndSign(ctx, signedJSON); err != nil {
+		return fmt.Errorf("cannot patch and sign file: %w", err)
+	}
+
+	if err := s.publish(ctx, signedJSON, newMetadata, fetchedAt, original); err != nil {
 		return err
 	}
 
-	if err := s.signer.VerifySignature(signedJSON.GetUnsigned(), signedJSON.Signature); err != nil {
+	s.metadata = newMetadata
+
+	metrics.RefreshSuccesses.Inc()
+
+	return nil
+}
+
+func (s *Service) verifyOriginal(ctx context.Context, signedJSON *types.SignedUpdateJSON) (err error) {
+	_, span := tracing.Start(ctx, "VerifySignature")
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.upstreamVerifier.VerifySignature(signedJSON.GetUnsigned(), signedJSON.Signature); err != nil {
 		return fmt.Errorf("cannot verify original file signature: %w", err)
 	}
 
-	if err := s.patchAndSign(signedJSON); err != nil {
-		return fmt.Errorf("cannot patch and sign file: %w", err)
+	return nil
+}
+
+// failed counts the refresh failure at the stage and keeps it for the status report
+func (s *Service) failed(stage string, err error) error {
+	metrics.RefreshFailures.WithLabelValues(stage).Inc()
+
+	s.patchedMu.Lock()
+	s.lastError = &RefreshError{Time: time.Now(), Stage: stage, Message: err.Error()}
+	s.consecutiveFailures++
+	s.patchedMu.Unlock()
+
+	return err
+}
+
+// publish writes the signed document to the served files and makes it the current one
+func (s *Service) publish(ctx context.Context, signedJSON *types.SignedUpdateJSON, source sourcefileproviders.FileMetadata, fetchedAt time.Time, original []byte) error {
+	if err := s.writeFiles(ctx, s.cfg.DataDirPath, signedJSON, servedFiles); err != nil {
+		return s.failed(metrics.StageWrite, err)
+	}
+
+	if generatedAt, err := time.Parse(time.RFC3339, signedJSON.GenerationTimestamp); err == nil {
+		metrics.SetFeedGeneration(generatedAt)
+	}
+
+	s.patchedMu.Lock()
+	s.patched = signedJSON
+	s.patchedAt = time.Now()
+	s.previous, s.current = s.current, &Generation{
+		GenerationTimestamp: signedJSON.GenerationTimestamp,
+		FetchedAt:           fetchedAt,
+		PublishedAt:         s.patchedAt,
+		Source:              source,
+		Digest512:           signedJSON.Signature.CorrectDigest512,
+		original:            original,
 	}
+	s.consecutiveFailures, s.lastError = 0, nil
+	s.patchedMu.Unlock()
+
+	return nil
+}
 
+// succeeded ends the failure streak when the original file is checked successfully and did not change
+func (s *Service) succeeded() {
+	s.patchedMu.Lock()
+	s.consecutiveFailures, s.lastError = 0, nil
+	s.patchedMu.Unlock()
+}
+
+func (s *Service) writeFiles(ctx context.Context, dir string, signedJSON *types.SignedUpdateJSON, files []wrappedFile) (err error) {
+	ctx, span := tracing.Start(ctx, "WriteFiles")
+	defer func() { tracing.End(span, err) }()
+
+	_, marshalSpan := tracing.Start(ctx, "MarshalJSON")
 	bytez, err := signedJSON.MarshalJSON()
+	tracing.End(marshalSpan, err)
+
 	if err != nil {
 		return fmt.Errorf("failed to write patched content to buffer: %w", err)
 	}
 
-	f, err := os.Create(jsonpFile) //nolint:gosec
+	for _, file := range files {
+		filePath := path.Join(dir, file.name)
+
+		_, writeSpan := tracing.Start(ctx, "WriteFile", attribute.String("file.path", filePath))
+		err = s.writeFile(filePath, bytez, file)
+		tracing.End(writeSpan, err)
+
+		if err != nil {
+			return err
+		}
+
+		s.log.Debugf("%s file saved", filePath)
+	}
+
+	return nil
+}
+
+func (s *Service) writeFile(filePath string, bytez []byte, file wrappedFile) error {
+	f, err := os.Create(filePath) //nolint:gosec
 	if err != nil {
-		return fmt.Errorf("failed to create file %s: %w", jsonpFile, err)
+		return fmt.Errorf("failed to create file %s: %w", filePath, err)
 	}
 	defer f.Close()
 
-	if err := s.writeDataWithTrailers(f, bytes.NewReader(bytez), sourcefileproviders.WrappedJSONPPrefix, sourcefileproviders.WrappedJSONPSuffix); err != nil {
-		return fmt.Errorf("cannot write %s: %w", jsonpFile, err)
+	if err := s.writeDataWithTrailers(f, bytes.NewReader(bytez), file.prefix, file.suffix); err != nil {
+		return fmt.Errorf("cannot write %s: %w", filePath, err)
 	}
 
-	s.log.Debugf("%s file saved", jsonpFile)
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("cannot close %s: %w", filePath, err)
+	}
+
+	return nil
+}
 
-	f, err = os.Create(htmlFile) //nolint:gosec
+// SignOnce fetches, verifies, patches and signs the original file once and writes all its variants to the directory
+func (s *Service) SignOnce(ctx context.Context, dir string) error {
+	_, signedJSON, err := s.GetOriginal(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create file %s: %w", htmlFile, err)
+		return s.failed(metrics.StageFetch, err)
 	}
-	defer f.Close()
 
-	if err := s.writeDataWithTrailers(f, bytes.NewReader(bytez), sourcefileproviders.WrappedHTMLPrefix, sourcefileproviders.WrappedHTMLSuffix); err != nil {
-		return fmt.Errorf("cannot write %s: %w", htmlFile, err)
+	if err := s.verifyOriginal(ctx, signedJSON); err != nil {
+		return s.failed(metrics.StageVerify, err)
 	}
 
-	s.log.Debugf("%s file saved", htmlFile)
+	if err := s.patchAndSign(ctx, signedJSON); err != nil {
+		return fmt.Errorf("cannot patch and sign file: %w", err)
+	}
 
-	s.metadata = newMetadata
+	if err := s.writeFiles(ctx, dir, signedJSON, staticFiles); err != nil {
+		return s.failed(metrics.StageWrite, err)
+	}
 
 	return nil
 }
 
-func (s *Service) patchAndSign(signedJSON *types.SignedUpdateJSON) error {
-	for _, patcher := range s.patchers {
-		if err := patcher.Patch(signedJSON.GetUnsigned()); err != nil {
+// isResignDue reports whether the signer switched to other signing material since the current document was signed
+func (s *Service) isResignDue() bool {
+	rs, ok := s.signer.(RotatableSigner)
+	if !ok {
+		return false
+	}
+
+	s.patchedMu.RLock()
+	defer s.patchedMu.RUnlock()
+
+	return s.patched != nil && !slices.Equal(s.patched.Signature.Certificates, rs.SigningCertificates())
+}
+
+// resign signs the currently served document with the current signing material without fetching the original file
+func (s *Service) resign(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.isResignDue() {
+		return nil
+	}
+
+	s.log.Info("signing material changed, re-signing the current document")
+
+	metrics.RefreshAttempts.Inc()
+
+	resigned := &types.SignedUpdateJSON{
+		InsecureUpdateJSON: s.GetPatchedUpdateJSON().GetUnsigned(),
+	}
+
+	if err := resigned.Sign(s.signingContext(ctx, resigned, "resign"), s.signer); err != nil {
+		return s.failed(metrics.StageSign, fmt.Errorf("cannot re-sign file: %w", err))
+	}
+
+	s.patchedMu.RLock()
+	patchedAt, current := s.patchedAt, *s.current
+	s.patchedMu.RUnlock()
+
+	// the original file is not fetched again, the document is the same generation signed anew
+	if err := s.publish(ctx, resigned, current.Source, current.FetchedAt, current.original); err != nil {
+		return err
+	}
+
+	// re-signing does not re-evaluate the fallbacks
+	s.patchedMu.Lock()
+	s.patchedAt = patchedAt
+	s.patchedMu.Unlock()
+
+	metrics.RefreshSuccesses.Inc()
+
+	return nil
+}
+
+// isFallbackRecheckDue reports whether the artifacts moved to the fallback mirrors should be checked on the primary one again
+func (s *Service) isFallbackRecheckDue() bool {
+	s.patchedMu.RLock()
+	defer s.patchedMu.RUnlock()
+
+	if s.patched == nil || len(s.patched.MirrorFallbacks) == 0 {
+		return false
+	}
+
+	if time.Since(s.patchedAt) < s.cfg.Patch.FallbackRecheckInterval {
+		return false
+	}
+
+	s.log.Infof("%d artifacts are served from fallbacks, re-evaluating", len(s.patched.MirrorFallbacks))
+
+	return true
+}
+
+// GetPatchedUpdateJSON returns the currently served patched and signed document, it must not be modified
+func (s *Service) GetPatchedUpdateJSON() *types.SignedUpdateJSON {
+	s.patchedMu.RLock()
+	defer s.patchedMu.RUnlock()
+
+	return s.patched
+}
+
+// Patch applies all the configured patchers to the document
+func (s *Service) Patch(ctx context.Context, signedJSON *types.SignedUpdateJSON) error {
+	return patch(ctx, s.patchers, signedJSON)
+}
+
+func patch(ctx context.Context, patchers []types.Patcher, signedJSON *types.SignedUpdateJSON) error {
+	for _, patcher := range patchers {
+		patchCtx, span := tracing.Start(ctx, "Patch", attribute.String("patcher", patcher.Name()))
+		err := patcher.Patch(patchCtx, signedJSON.GetUnsigned())
+		tracing.End(span, err)
+
+		if err != nil {
 			return fmt.Errorf("cannot patch original file: %w", err)
 		}
 	}
 
-	if err := signedJSON.Sign(s.signer); err != nil {
-		return fmt.Errorf("cannot attach new signature: %w", err)
+	return nil
+}
+
+func (s *Service) patchAndSign(ctx context.Context, signedJSON *types.SignedUpdateJSON) error {
+	if err := s.Patch(ctx, signedJSON); err != nil {
+		return s.failed(metrics.StagePatch, err)
+	}
+
+	if err := signedJSON.Sign(s.signingContext(ctx, signedJSON, "refresh"), s.signer); err != nil {
+		return s.failed(metrics.StageSign, fmt.Errorf("cannot attach new signature: %w", err))
 	}
 
 	return nil
 }
+
+// signingContext describes the patched document for the signing log
+func (s *Service) signingContext(ctx context.Context, signedJSON *types.SignedUpdateJSON, source string) context.Context {
+	patchers := make([]string, 0, len(s.patchers))
+	for _, patcher := range s.patchers {
+		patchers = append(patchers, patcher.Name())
+	}
+
+	return types.WithSigningDetails(ctx, types.SigningDetails{
+		Source:              source,
+		GenerationTimestamp: signedJSON.GenerationTimestamp,
+		Patchers:            patchers,
+	})
+}
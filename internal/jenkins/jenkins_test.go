@@ -1,15 +1,29 @@
 package jenkins
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"go.uber.org/zap"
 
 	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/patcher"
 	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/signer"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/sourcefileproviders"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/sourcefileproviders/localfile"
 	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/sourcefileproviders/remoteurl"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/types"
 )
 
 func TestCurrentUpdateJSON(t *testing.T) {
@@ -38,7 +52,7 @@ func TestCurrentUpdateJSON(t *testing.T) {
 	juc := NewJenkinsUpdateCenter(log, config.AppConfig{
 		DataDirPath:              "/tmp",
 		GetUpdateJSONBodyTimeout: 128 * time.Second,
-	}, p, signerSvc, nil)
+	}, p, signerSvc, signerSvc, nil)
 
 	if err := juc.RefreshContent(ctx); err != nil {
 		t.Fatal(err)
@@ -46,3 +60,392 @@ func TestCurrentUpdateJSON(t *testing.T) {
 
 	t.Logf("%s is still supported", source)
 }
+
+func TestSignOnce(t *testing.T) {
+	var (
+		logger, _ = zap.NewDevelopment()
+		log       = logger.Sugar()
+	)
+
+	signerSvc, err := signer.NewSignerService(log, config.SignerConfig{
+		CertificatePath: "../../testdata/certs/test.crt",
+		KeyPath:         "../../testdata/certs/test.key",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := localfile.NewLocalFileProvider("../../testdata/update-center/update-center.jsonp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+
+	juc := NewJenkinsUpdateCenter(log, config.AppConfig{
+		GetUpdateJSONBodyTimeout: 10 * time.Second,
+	}, p, signerSvc, signerSvc, nil)
+
+	if err := juc.SignOnce(context.Background(), dir); err != nil {
+		t.Fatal(err)
+	}
+
+	plain, err := os.ReadFile(filepath.Join(dir, UpdateCenterActualJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, wrapping := range map[string][2][]byte{
+		UpdateCenterDotJSON: {sourcefileproviders.WrappedJSONPPrefix, sourcefileproviders.WrappedJSONPSuffix},
+		UpdateCenterDotHTML: {sourcefileproviders.WrappedHTMLPrefix, sourcefileproviders.WrappedHTMLSuffix},
+	} {
+		wrapped, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(wrapped, bytes.Join([][]byte{wrapping[0], plain, wrapping[1]}, nil)) {
+			t.Fatalf("%s does not wrap %s", name, UpdateCenterActualJSON)
+		}
+	}
+}
+
+type nopPatcher struct{}
+
+func (nopPatcher) Name() string {
+	return "nop"
+}
+
+func (nopPatcher) Patch(_ context.Context, _ *types.InsecureUpdateJSON) error {
+	return nil
+}
+
+func TestSignOnceSpans(t *testing.T) {
+	var (
+		logger, _ = zap.NewDevelopment()
+		log       = logger.Sugar()
+		recorder  = tracetest.NewSpanRecorder()
+	)
+
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	signerSvc, err := signer.NewSignerService(log, config.SignerConfig{
+		CertificatePath: "../../testdata/certs/test.crt",
+		KeyPath:         "../../testdata/certs/test.key",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := localfile.NewLocalFileProvider("../../testdata/update-center/update-center.jsonp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	juc := NewJenkinsUpdateCenter(log, config.AppConfig{
+		GetUpdateJSONBodyTimeout: 10 * time.Second,
+	}, p, signerSvc, signerSvc, []types.Patcher{nopPatcher{}})
+
+	if err := juc.SignOnce(context.Background(), t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := map[string]int{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()]++
+	}
+
+	for name, count := range map[string]int{
+		"GetOriginal":     1,
+		"DecodeJSON":      1,
+		"VerifySignature": 2,
+		"Patch":           1,
+		"GetSignature":    1,
+		"RSASign":         1,
+		"WriteFiles":      1,
+		"WriteFile":       3,
+	} {
+		if spans[name] != count {
+			t.Fatalf("%d %s spans recorded, expected %d: %v", spans[name], name, count, spans)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	var (
+		logger, _ = zap.NewDevelopment()
+		log       = logger.Sugar()
+		ctx       = context.Background()
+	)
+
+	signerSvc, err := signer.NewSignerService(log, config.SignerConfig{
+		CertificatePath: "../../testdata/certs/test.crt",
+		KeyPath:         "../../testdata/certs/test.key",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := localfile.NewLocalFileProvider("../../testdata/update-center/update-center.jsonp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	juc := NewJenkinsUpdateCenter(log, config.AppConfig{
+		DataDirPath:              t.TempDir(),
+		GetUpdateJSONBodyTimeout: 10 * time.Second,
+	}, p, signerSvc, signerSvc, []types.Patcher{nopPatcher{}})
+
+	if status := juc.Status(); status.Current != nil || status.Previous != nil {
+		t.Fatalf("generation reported before the first refresh: %+v", status)
+	}
+
+	if _, _, err := juc.GetOriginalBody(); !errors.Is(err, ErrNoGeneration) {
+		t.Fatalf("original file served before the first refresh: %v", err)
+	}
+
+	if err := juc.RefreshContent(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// the original file did not change, nothing is regenerated
+	if err := juc.RefreshContent(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if status := juc.Status(); status.Current == nil || status.Previous != nil {
+		t.Fatalf("single generation expected: %+v", status)
+	}
+
+	if err := juc.ForceRefresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	status := juc.Status()
+	if status.Current == nil || status.Previous == nil {
+		t.Fatalf("forced refresh did not publish a generation: %+v", status)
+	}
+
+	if status.Current.GenerationTimestamp != juc.GetPatchedUpdateJSON().GenerationTimestamp ||
+		status.Current.Digest512 != juc.GetPatchedUpdateJSON().Signature.CorrectDigest512 ||
+		status.Current.Source.Size == 0 || status.Current.FetchedAt.IsZero() {
+		t.Fatalf("unexpected current generation %+v", status.Current)
+	}
+
+	if status.LastError != nil {
+		t.Fatalf("unexpected refresh error %+v", status.LastError)
+	}
+
+	if len(status.Patchers) != 1 || status.Patchers[0].Name != "nop" {
+		t.Fatalf("unexpected patchers %+v", status.Patchers)
+	}
+
+	metadata, body, err := juc.GetOriginalBody()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var original types.SignedUpdateJSON
+	if err := json.Unmarshal(body, &original); err != nil {
+		t.Fatal(err)
+	}
+
+	// the upstream document is served, not the resigned one
+	if metadata != status.Current.Source || original.InsecureUpdateJSON == nil ||
+		original.GenerationTimestamp != status.Current.GenerationTimestamp ||
+		original.Signature.CorrectSignature512 == juc.GetPatchedUpdateJSON().Signature.CorrectSignature512 {
+		t.Fatalf("unexpected original file %+v", metadata)
+	}
+}
+
+func TestVariants(t *testing.T) {
+	var (
+		logger, _ = zap.NewDevelopment()
+		log       = logger.Sugar()
+		ctx       = context.Background()
+	)
+
+	signerSvc, err := signer.NewSignerService(log, config.SignerConfig{
+		CertificatePath: "../../testdata/certs/test.crt",
+		KeyPath:         "../../testdata/certs/test.key",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := localfile.NewLocalFileProvider("../../testdata/update-center/update-center.jsonp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.AppConfig{
+		DataDirPath:              t.TempDir(),
+		GetUpdateJSONBodyTimeout: 10 * time.Second,
+		Patch: config.PatchConfig{
+			OriginDownloadURL: "https://updates.jenkins.io",
+			NewDownloadURL:    "https://mirror.local",
+		},
+	}
+	cfg.Server.MirrorProfiles = config.MirrorProfilesConfig{Profiles: []string{"dc1=https://dc1.mirror"}, MaxVariants: 1}
+
+	juc := NewJenkinsUpdateCenter(log, cfg, p, signerSvc, signerSvc, []types.Patcher{patcher.NewPatcher(log, cfg.Patch), nopPatcher{}})
+
+	if _, err := juc.GetVariant(ctx, "https://dc1.mirror"); err == nil {
+		t.Fatal("variant made before the first generation")
+	}
+
+	if err := juc.RefreshContent(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// the concurrent requests share the single signing of the variant
+	var (
+		wg       sync.WaitGroup
+		variants = make([]*Variant, 8)
+		errs     = make([]error, len(variants))
+	)
+
+	for i := range variants {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			variants[i], errs[i] = juc.GetVariant(ctx, "https://dc1.mirror")
+		}()
+	}
+
+	wg.Wait()
+
+	v := variants[0]
+
+	for i := range variants {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+
+		if variants[i] != v {
+			t.Fatal("variant is signed more than once for the concurrent requests")
+		}
+	}
+
+	body := v.Files[UpdateCenterDotJSON]
+	if !bytes.HasPrefix(body, sourcefileproviders.WrappedJSONPPrefix) || !bytes.Contains(body, []byte("https://dc1.mirror/download/")) ||
+		bytes.Contains(body, []byte("https://updates.jenkins.io/download/")) {
+		t.Fatal("variant downloads are not pointed to the profile mirror")
+	}
+
+	// the variant is patched by its own copy of the configured patchers
+	status := juc.Status()
+	if stats, ok := status.Patchers[0].Stats.(*patcher.DownloadURLStats); !ok || stats.To != "https://mirror.local" ||
+		!strings.HasPrefix(juc.GetPatchedUpdateJSON().Core.URL, "https://mirror.local/") {
+		t.Fatalf("served feed is patched for the variant: %+v", status.Patchers)
+	}
+
+	if cached, _ := juc.GetVariant(ctx, "https://dc1.mirror"); cached != v {
+		t.Fatal("variant is signed again within the generation")
+	}
+
+	if _, err := juc.GetVariant(ctx, "https://dc2.mirror"); !errors.Is(err, ErrTooManyVariants) {
+		t.Fatalf("variants limit is not applied: %v", err)
+	}
+
+	if status := juc.Status(); len(status.Variants) != 1 || status.Variants[0].DownloadURL != "https://dc1.mirror" {
+		t.Fatalf("unexpected variants %+v", status.Variants)
+	}
+
+	// the next generation gets its own variants
+	if err := juc.ForceRefresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if status := juc.Status(); len(status.Variants) != 0 {
+		t.Fatalf("variants of the previous generation reported %+v", status.Variants)
+	}
+
+	next, err := juc.GetVariant(ctx, "https://dc2.mirror")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Contains(next.Files[UpdateCenterDotHTML], []byte("https://dc2.mirror/download/")) {
+		t.Fatal("variant of the next generation is not pointed to the profile mirror")
+	}
+}
+
+type countingPatcher struct {
+	runs *int
+}
+
+func (countingPatcher) Name() string {
+	return "counting"
+}
+
+func (p countingPatcher) Patch(_ context.Context, _ *types.InsecureUpdateJSON) error {
+	*p.runs++
+	return nil
+}
+
+func TestAvailabilityChecksOffRequestPath(t *testing.T) {
+	var (
+		logger, _ = zap.NewDevelopment()
+		log       = logger.Sugar()
+		ctx       = context.Background()
+		runs      int
+	)
+
+	signerSvc, err := signer.NewSignerService(log, config.SignerConfig{
+		CertificatePath: "../../testdata/certs/test.crt",
+		KeyPath:         "../../testdata/certs/test.key",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original, err := os.ReadFile("../../testdata/update-center/update-center.jsonp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sourcePath := filepath.Join(t.TempDir(), "update-center.jsonp")
+	if err := os.WriteFile(sourcePath, original, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := localfile.NewLocalFileProvider(sourcePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	juc := NewJenkinsUpdateCenter(log, config.AppConfig{
+		DataDirPath:              t.TempDir(),
+		GetUpdateJSONBodyTimeout: 10 * time.Second,
+		Patch:                    config.PatchConfig{CheckAvailability: true},
+	}, p, signerSvc, signerSvc, []types.Patcher{countingPatcher{runs: &runs}})
+
+	// the first generation is made whoever asks for it
+	if err := juc.RefreshContent(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chtimes(sourcePath, time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := juc.RefreshContent(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if runs != 1 {
+		t.Fatalf("feed request patched the changed original file, %d runs", runs)
+	}
+
+	if err := juc.refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if runs != 2 {
+		t.Fatalf("background refresh did not patch the changed original file, %d runs", runs)
+	}
+}
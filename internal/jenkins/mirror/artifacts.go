@@ -0,0 +1,87 @@
+package mirror
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/types"
+)
+
+const (
+	CoreArtifactName = "core"
+)
+
+type Artifact struct {
+	Name   string
+	URL    string
+	SHA256 string
+	Size   int64
+}
+
+// RewrittenArtifacts returns the core and plugin artifacts whose download URL points to the mirror
+func RewrittenArtifacts(insecureJSON *types.InsecureUpdateJSON, mirrorURL string) []Artifact {
+	artifacts := make([]Artifact, 0, len(insecureJSON.Plugins)+1)
+
+	// https://mirror must not match https://mirror.other
+	mirrorURL = strings.TrimSuffix(mirrorURL, "/") + "/"
+
+	if strings.HasPrefix(insecureJSON.Core.URL, mirrorURL) {
+		artifacts = append(artifacts, Artifact{
+			Name:   CoreArtifactName,
+			URL:    insecureJSON.Core.URL,
+			SHA256: insecureJSON.Core.Sha256,
+			Size:   insecureJSON.Core.Size,
+		})
+	}
+
+	for pluginName, pluginInfo := range insecureJSON.Plugins {
+		if !strings.HasPrefix(pluginInfo.URL, mirrorURL) {
+			continue
+		}
+
+		artifacts = append(artifacts, Artifact{
+			Name:   pluginName,
+			URL:    pluginInfo.URL,
+			SHA256: pluginInfo.SHA256,
+			Size:   pluginInfo.Size,
+		})
+	}
+
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].Name < artifacts[j].Name
+	})
+
+	return artifacts
+}
+
+// ForEach calls fn for every artifact using up to concurrency goroutines, it stops scheduling once ctx is done
+func ForEach(ctx context.Context, artifacts []Artifact, concurrency int, fn func(ctx context.Context, artifact Artifact)) {
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, max(concurrency, 1))
+	)
+
+	for _, artifact := range artifacts {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+
+		go func(artifact Artifact) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			fn(ctx, artifact)
+		}(artifact)
+	}
+
+	wg.Wait()
+}
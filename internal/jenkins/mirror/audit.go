@@ -0,0 +1,260 @@
+package mirror
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/types"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/metrics"
+)
+
+type Problem string
+
+const (
+	ProblemMissing          Problem = "missing"
+	ProblemChecksumMismatch Problem = "checksum-mismatch"
+	ProblemError            Problem = "error"
+)
+
+type UpdateJSONProvider interface {
+	GetPatchedUpdateJSON() *types.SignedUpdateJSON
+}
+
+type ArtifactReport struct {
+	URL        string  `json:"url"`
+	Problem    Problem `json:"problem"`
+	StatusCode int     `json:"statusCode,omitempty"`
+	Detail     string  `json:"detail,omitempty"`
+}
+
+type Summary struct {
+	Artifacts  int `json:"artifacts"`
+	Available  int `json:"available"`
+	Sampled    int `json:"sampled"`
+	Missing    int `json:"missing"`
+	Mismatched int `json:"mismatched"`
+	Errors     int `json:"errors"`
+}
+
+type Report struct {
+	StartedAt           time.Time `json:"startedAt"`
+	FinishedAt          time.Time `json:"finishedAt"`
+	MirrorURL           string    `json:"mirrorUrl"`
+	GenerationTimestamp string    `json:"generationTimestamp"`
+
+	Summary Summary `json:"summary"`
+
+	// Plugins holds the problematic artifacts only, keyed by plugin name
+	Plugins map[string]ArtifactReport `json:"plugins"`
+}
+
+func (r *Report) HasProblems() bool {
+	return len(r.Plugins) > 0
+}
+
+func (r *Report) add(name string, ar ArtifactReport) {
+	switch ar.Problem {
+	case ProblemMissing:
+		r.Summary.Missing++
+	case ProblemChecksumMismatch:
+		r.Summary.Mismatched++
+	case ProblemError:
+		r.Summary.Errors++
+	}
+
+	r.Plugins[name] = ar
+}
+
+type Auditor struct {
+	log *zap.SugaredLogger
+	cfg config.MirrorAuditConfig
+
+	prober    *Prober
+	mirrorURL string
+
+	mu         sync.RWMutex
+	lastReport *Report
+}
+
+func NewAuditor(log *zap.SugaredLogger, cfg config.MirrorAuditConfig, mirrorURL string) *Auditor {
+	return &Auditor{
+		log:       log,
+		cfg:       cfg,
+		prober:    NewProber(log, cfg.Timeout, cfg.DownloadTimeout),
+		mirrorURL: mirrorURL,
+	}
+}
+
+func (a *Auditor) LastReport() *Report {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.lastReport
+}
+
+// recordMetrics exports the summary of the report and its broken plugins, the recovered ones are dropped
+func recordMetrics(report *Report) {
+	metrics.MirrorAuditPluginProblems.Reset()
+
+	for name, ar := range report.Plugins {
+		if ar.Problem == ProblemMissing || ar.Problem == ProblemChecksumMismatch {
+			metrics.MirrorAuditPluginProblems.WithLabelValues(name, string(ar.Problem)).Set(1)
+		}
+	}
+
+	for result, count := range map[string]int{
+		"available":                     report.Summary.Available,
+		string(ProblemMissing):          report.Summary.Missing,
+		string(ProblemChecksumMismatch): report.Summary.Mismatched,
+		string(ProblemError):            report.Summary.Errors,
+	} {
+		metrics.MirrorAuditArtifacts.WithLabelValues(result).Set(float64(count))
+	}
+
+	metrics.MirrorAuditTimestamp.Set(float64(report.FinishedAt.Unix()))
+}
+
+func (a *Auditor) Audit(ctx context.Context, insecureJSON *types.InsecureUpdateJSON) *Report {
+	report := &Report{
+		StartedAt:           time.Now(),
+		MirrorURL:           a.mirrorURL,
+		GenerationTimestamp: insecureJSON.GenerationTimestamp,
+		Plugins:             map[string]ArtifactReport{},
+	}
+
+	artifacts := RewrittenArtifacts(insecureJSON, a.mirrorURL)
+	report.Summary.Artifacts = len(artifacts)
+
+	a.log.Infof("auditing %d artifacts on %s", len(artifacts), a.mirrorURL)
+
+	available := a.headArtifacts(ctx, artifacts, report)
+	report.Summary.Available = len(available)
+
+	sampled := a.sample(available)
+	report.Summary.Sampled = len(sampled)
+
+	a.hashArtifacts(ctx, sampled, report)
+
+	report.FinishedAt = time.Now()
+
+	recordMetrics(report)
+
+	a.mu.Lock()
+	a.lastReport = report
+	a.mu.Unlock()
+
+	a.log.Infof("mirror audit finished in %s: %d artifacts, %d missing, %d mismatched, %d errors (%d sampled)",
+		report.FinishedAt.Sub(report.StartedAt), report.Summary.Artifacts, report.Summary.Missing,
+		report.Summary.Mismatched, report.Summary.Errors, report.Summary.Sampled)
+
+	return report
+}
+
+func (a *Auditor) headArtifacts(ctx context.Context, artifacts []Artifact, report *Report) []Artifact {
+	var (
+		mu        sync.Mutex
+		available = make([]Artifact, 0, len(artifacts))
+	)
+
+	ForEach(ctx, artifacts, a.cfg.Concurrency, func(ctx context.Context, artifact Artifact) {
+		presence, statusCode, err := a.prober.Head(ctx, artifact.URL)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case err != nil:
+			report.add(artifact.Name, ArtifactReport{URL: artifact.URL, Problem: ProblemError, StatusCode: statusCode, Detail: err.Error()})
+		case presence == PresenceMissing:
+			report.add(artifact.Name, ArtifactReport{URL: artifact.URL, Problem: ProblemMissing, StatusCode: statusCode})
+		default:
+			available = append(available, artifact)
+		}
+	})
+
+	return available
+}
+
+func (a *Auditor) sample(artifacts []Artifact) []Artifact {
+	if a.cfg.SampleRate <= 0 || len(artifacts) == 0 {
+		return nil
+	}
+
+	n := min(int(math.Ceil(a.cfg.SampleRate*float64(len(artifacts)))), len(artifacts))
+
+	sampled := make([]Artifact, 0, n)
+	for _, i := range rand.Perm(len(artifacts))[:n] { //nolint:gosec
+		sampled = append(sampled, artifacts[i])
+	}
+
+	return sampled
+}
+
+func (a *Auditor) hashArtifacts(ctx context.Context, artifacts []Artifact, report *Report) {
+	var mu sync.Mutex
+
+	ForEach(ctx, artifacts, a.cfg.Concurrency, func(ctx context.Context, artifact Artifact) {
+		digest, err := a.prober.SHA256(ctx, artifact.URL)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case err != nil:
+			report.add(artifact.Name, ArtifactReport{URL: artifact.URL, Problem: ProblemError, Detail: err.Error()})
+		case !isDigestMatch(digest, artifact.SHA256):
+			report.add(artifact.Name, ArtifactReport{
+				URL:     artifact.URL,
+				Problem: ProblemChecksumMismatch,
+				Detail:  fmt.Sprintf("expected sha256 %s, got %s", artifact.SHA256, base64.StdEncoding.EncodeToString(digest)),
+			})
+		}
+	})
+}
+
+func isDigestMatch(computedDigest []byte, providedDigest string) bool {
+	return providedDigest == base64.StdEncoding.EncodeToString(computedDigest) ||
+		strings.EqualFold(providedDigest, hex.EncodeToString(computedDigest))
+}
+
+// RunWorker audits the mirror at startup and then every interval
+func (a *Auditor) RunWorker(ctx context.Context, feed UpdateJSONProvider) {
+	a.log.Infow("starting mirror audit worker")
+	defer a.log.Infow("mirror audit worker stopped")
+
+	ticker := time.NewTicker(a.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		a.auditFeed(ctx, feed)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Auditor) auditFeed(ctx context.Context, feed UpdateJSONProvider) {
+	signedJSON := feed.GetPatchedUpdateJSON()
+	if signedJSON == nil {
+		a.log.Warn("no patched update-center.json available yet, skipping mirror audit")
+		return
+	}
+
+	report := a.Audit(ctx, signedJSON.GetUnsigned())
+	for name, ar := range report.Plugins {
+		a.log.Warnf("mirror audit: %s (%s): %s %s", name, ar.URL, ar.Problem, ar.Detail)
+	}
+}
@@ -0,0 +1,215 @@
+package mirror
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/types"
+)
+
+func sha256Base64(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func TestAudit(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+
+	files := map[string]string{
+		"/plugins/good/1.0/good.hpi":           "good",
+		"/plugins/corrupted/1.0/corrupted.hpi": "corrupted",
+		"/war/2.472/jenkins.war":               "war",
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := files[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	insecureJSON := &types.InsecureUpdateJSON{
+		Core: types.Core{
+			URL:    srv.URL + "/war/2.472/jenkins.war",
+			Sha256: sha256Base64("war"),
+		},
+		Plugins: map[string]types.Plugin{
+			"good": {
+				URL:    srv.URL + "/plugins/good/1.0/good.hpi",
+				SHA256: sha256Base64("good"),
+			},
+			"corrupted": {
+				URL:    srv.URL + "/plugins/corrupted/1.0/corrupted.hpi",
+				SHA256: sha256Base64("original"),
+			},
+			"missing": {
+				URL:    srv.URL + "/plugins/missing/1.0/missing.hpi",
+				SHA256: sha256Base64("missing"),
+			},
+			"upstream": {
+				URL: "https://updates.jenkins.io/download/plugins/upstream/1.0/upstream.hpi",
+			},
+			// the same prefix, another port
+			"lookalike": {
+				URL: srv.URL + "0/plugins/lookalike/1.0/lookalike.hpi",
+			},
+		},
+	}
+
+	a := NewAuditor(logger.Sugar(), config.MirrorAuditConfig{
+		SampleRate:      1,
+		Concurrency:     2,
+		Timeout:         5 * time.Second,
+		DownloadTimeout: 5 * time.Second,
+	}, srv.URL)
+
+	report := a.Audit(context.Background(), insecureJSON)
+
+	if report.Summary.Artifacts != 4 {
+		t.Fatalf("expected 4 rewritten artifacts, got %d", report.Summary.Artifacts)
+	}
+
+	if report.Summary.Missing != 1 || report.Plugins["missing"].Problem != ProblemMissing {
+		t.Fatalf("missing plugin is not reported: %+v", report.Plugins)
+	}
+
+	if report.Summary.Mismatched != 1 || report.Plugins["corrupted"].Problem != ProblemChecksumMismatch {
+		t.Fatalf("corrupted plugin is not reported: %+v", report.Plugins)
+	}
+
+	if _, ok := report.Plugins["good"]; ok {
+		t.Fatal("good plugin is reported")
+	}
+
+	if _, ok := report.Plugins[CoreArtifactName]; ok {
+		t.Fatal("core is reported")
+	}
+
+	if a.LastReport() != report {
+		t.Fatal("last report is not kept")
+	}
+
+	if problems := pluginProblems(t); len(problems) != 2 || problems["missing"] != ProblemMissing ||
+		problems["corrupted"] != ProblemChecksumMismatch {
+		t.Fatalf("unexpected plugin problems exported %v", problems)
+	}
+
+	// the recovered plugins drop out
+	files["/plugins/missing/1.0/missing.hpi"] = "missing"
+	files["/plugins/corrupted/1.0/corrupted.hpi"] = "original"
+
+	a.Audit(context.Background(), insecureJSON)
+
+	if problems := pluginProblems(t); len(problems) != 0 {
+		t.Fatalf("recovered plugins exported %v", problems)
+	}
+}
+
+func pluginProblems(t *testing.T) map[string]Problem {
+	t.Helper()
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	problems := map[string]Problem{}
+
+	for _, mf := range families {
+		if mf.GetName() != "resigner_mirror_audit_plugin_problems" {
+			continue
+		}
+
+		for _, m := range mf.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+
+			problems[labels["plugin"]] = Problem(labels["problem"])
+		}
+	}
+
+	return problems
+}
+
+type staticFeed struct {
+	signedJSON *types.SignedUpdateJSON
+}
+
+func (f staticFeed) GetPatchedUpdateJSON() *types.SignedUpdateJSON {
+	return f.signedJSON
+}
+
+func TestAuditWorker(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	a := NewAuditor(logger.Sugar(), config.MirrorAuditConfig{
+		Interval:    time.Hour,
+		Concurrency: 1,
+		Timeout:     5 * time.Second,
+	}, srv.URL)
+
+	feed := staticFeed{signedJSON: &types.SignedUpdateJSON{InsecureUpdateJSON: &types.InsecureUpdateJSON{
+		Core: types.Core{URL: srv.URL + "/war/2.472/jenkins.war"},
+	}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go a.RunWorker(ctx, feed)
+
+	// the first audit does not wait for the interval
+	deadline := time.Now().Add(5 * time.Second)
+
+	for a.LastReport() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("mirror is not audited at startup")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if report := a.LastReport(); report.Summary.Missing != 1 {
+		t.Fatalf("unexpected startup report %+v", report.Summary)
+	}
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exported := false
+
+	for _, mf := range families {
+		if mf.GetName() != "resigner_mirror_audit_artifacts" {
+			continue
+		}
+
+		for _, m := range mf.GetMetric() {
+			if m.GetLabel()[0].GetValue() == string(ProblemMissing) {
+				exported = m.GetGauge().GetValue() == 1
+			}
+		}
+	}
+
+	if !exported {
+		t.Fatal("missing artifacts are not exported")
+	}
+}
@@ -0,0 +1,251 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+)
+
+type Mirror struct {
+	URL     string       `json:"url"`
+	Weight  int          `json:"weight"`
+	Subnets []*net.IPNet `json:"-"`
+
+	Healthy           bool      `json:"healthy"`
+	LastCheck         time.Time `json:"lastCheck"`
+	LastError         string    `json:"lastError,omitempty"`
+	failedChecksInRow int
+}
+
+func (m *Mirror) matches(ip net.IP) bool {
+	for _, subnet := range m.Subnets {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseMirrorSpec parses URL[,weight=N][,subnet=CIDR...] mirror specification
+func ParseMirrorSpec(spec string) (*Mirror, error) {
+	parts := strings.Split(spec, ",")
+
+	u := strings.TrimSpace(parts[0])
+	if _, err := url.ParseRequestURI(u); err != nil {
+		return nil, fmt.Errorf("mirror URL %q is incorrect: %w", u, err)
+	}
+
+	m := &Mirror{
+		URL:     strings.TrimSuffix(u, "/"),
+		Weight:  1,
+		Healthy: true,
+	}
+
+	for _, part := range parts[1:] {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("mirror option %q is not a key=value pair", part)
+		}
+
+		switch key {
+		case "weight":
+			weight, err := strconv.Atoi(value)
+			if err != nil || weight < 1 {
+				return nil, fmt.Errorf("mirror weight %q must be a positive integer", value)
+			}
+
+			m.Weight = weight
+		case "subnet":
+			_, subnet, err := net.ParseCIDR(value)
+			if err != nil {
+				return nil, fmt.Errorf("mirror subnet %q is incorrect: %w", value, err)
+			}
+
+			m.Subnets = append(m.Subnets, subnet)
+		default:
+			return nil, fmt.Errorf("unknown mirror option %q", key)
+		}
+	}
+
+	return m, nil
+}
+
+// Pool picks the mirrors clients are redirected to
+type Pool struct {
+	log *zap.SugaredLogger
+	cfg config.RedirectConfig
+
+	prober *Prober
+
+	mu      sync.RWMutex
+	mirrors []*Mirror
+}
+
+func NewPool(log *zap.SugaredLogger, cfg config.RedirectConfig, defaultMirrorURL string) (*Pool, error) {
+	specs := cfg.Mirrors
+	if len(specs) == 0 {
+		specs = []string{defaultMirrorURL}
+	}
+
+	p := &Pool{
+		log:     log,
+		cfg:     cfg,
+		prober:  NewProber(log, cfg.HealthCheckTimeout, 0),
+		mirrors: make([]*Mirror, 0, len(specs)),
+	}
+
+	for _, spec := range specs {
+		m, err := ParseMirrorSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		p.mirrors = append(p.mirrors, m)
+	}
+
+	return p, nil
+}
+
+// Mirrors returns a snapshot of the mirrors state
+func (p *Pool) Mirrors() []Mirror {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	mirrors := make([]Mirror, 0, len(p.mirrors))
+	for _, m := range p.mirrors {
+		mirrors = append(mirrors, *m)
+	}
+
+	return mirrors
+}
+
+// Pick chooses a healthy mirror by weight preferring the ones serving the client subnet,
+// mirrors bound to subnets are not offered to other clients while unbound ones are available
+func (p *Pool) Pick(clientIP net.IP) (string, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var affine, unbound, healthy []*Mirror
+
+	for _, m := range p.mirrors {
+		if !m.Healthy {
+			continue
+		}
+
+		healthy = append(healthy, m)
+
+		switch {
+		case clientIP != nil && m.matches(clientIP):
+			affine = append(affine, m)
+		case len(m.Subnets) == 0:
+			unbound = append(unbound, m)
+		}
+	}
+
+	for _, candidates := range [][]*Mirror{affine, unbound, healthy} {
+		if m := pickWeighted(candidates); m != nil {
+			return m.URL, true
+		}
+	}
+
+	return "", false
+}
+
+func pickWeighted(mirrors []*Mirror) *Mirror {
+	total := 0
+	for _, m := range mirrors {
+		total += m.Weight
+	}
+
+	if total == 0 {
+		return nil
+	}
+
+	n := rand.IntN(total) //nolint:gosec
+	for _, m := range mirrors {
+		if n < m.Weight {
+			return m
+		}
+
+		n -= m.Weight
+	}
+
+	return nil
+}
+
+func (p *Pool) checkHealth(ctx context.Context, m *Mirror) {
+	presence, _, err := p.prober.Head(ctx, m.URL+p.cfg.HealthCheckPath)
+	if err == nil && presence != PresenceAvailable {
+		err = fmt.Errorf("health check resource is %s", presence)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	m.LastCheck = time.Now()
+
+	if err == nil {
+		if !m.Healthy {
+			p.log.Infof("mirror %s is healthy again, returning it into rotation", m.URL)
+		}
+
+		m.Healthy, m.LastError, m.failedChecksInRow = true, "", 0
+
+		return
+	}
+
+	m.LastError = err.Error()
+	m.failedChecksInRow++
+
+	if m.Healthy && m.failedChecksInRow >= max(p.cfg.UnhealthyThreshold, 1) {
+		p.log.Warnf("mirror %s failed %d health checks in a row, taking it out of rotation: %v", m.URL, m.failedChecksInRow, err)
+
+		m.Healthy = false
+	}
+}
+
+func (p *Pool) CheckHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for _, m := range p.mirrors {
+		wg.Add(1)
+
+		go func(m *Mirror) {
+			defer wg.Done()
+
+			p.checkHealth(ctx, m)
+		}(m)
+	}
+
+	wg.Wait()
+}
+
+func (p *Pool) RunHealthChecker(ctx context.Context) {
+	p.log.Infow("starting mirrors health checker")
+	defer p.log.Infow("mirrors health checker stopped")
+
+	p.CheckHealth(ctx)
+
+	ticker := time.NewTicker(p.cfg.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.CheckHealth(ctx)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package mirror
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+)
+
+func TestParseMirrorSpec(t *testing.T) {
+	m, err := ParseMirrorSpec("https://mirror.local/jenkins/,weight=3,subnet=10.0.0.0/8,subnet=192.168.0.0/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.URL != "https://mirror.local/jenkins" || m.Weight != 3 || len(m.Subnets) != 2 {
+		t.Fatalf("unexpected mirror: %+v", m)
+	}
+
+	for _, spec := range []string{"mirror.local", "https://mirror.local/,weight=0", "https://mirror.local/,subnet=10.0.0.1", "https://mirror.local/,zone=a"} {
+		if _, err := ParseMirrorSpec(spec); err == nil {
+			t.Fatalf("invalid spec %q accepted", spec)
+		}
+	}
+}
+
+func TestPoolPick(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer healthy.Close()
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer broken.Close()
+
+	p, err := NewPool(logger.Sugar(), config.RedirectConfig{
+		Mirrors: []string{
+			healthy.URL + "/dc1,subnet=10.1.0.0/16",
+			healthy.URL + "/global,weight=2",
+			broken.URL + "/broken,weight=100",
+		},
+		HealthCheckPath:    "/",
+		HealthCheckTimeout: 5 * time.Second,
+		UnhealthyThreshold: 1,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.CheckHealth(context.Background())
+
+	for i := 0; i < 20; i++ {
+		if u, _ := p.Pick(net.ParseIP("10.1.2.3")); u != healthy.URL+"/dc1" {
+			t.Fatalf("client from 10.1.0.0/16 redirected to %s", u)
+		}
+
+		if u, _ := p.Pick(net.ParseIP("172.16.0.1")); u != healthy.URL+"/global" {
+			t.Fatalf("other client redirected to %s", u)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package mirror
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type Presence int
+
+const (
+	PresenceUnknown Presence = iota
+	PresenceAvailable
+	PresenceMissing
+)
+
+func (p Presence) String() string {
+	switch p {
+	case PresenceAvailable:
+		return "available"
+	case PresenceMissing:
+		return "missing"
+	default:
+		return "unknown"
+	}
+}
+
+type Prober struct {
+	log *zap.SugaredLogger
+
+	hc *http.Client
+
+	timeout         time.Duration
+	downloadTimeout time.Duration
+}
+
+func NewProber(log *zap.SugaredLogger, timeout, downloadTimeout time.Duration) *Prober {
+	return &Prober{
+		log:             log,
+		hc:              &http.Client{},
+		timeout:         timeout,
+		downloadTimeout: downloadTimeout,
+	}
+}
+
+// Head checks whether the artifact exists, redirects are followed
+func (p *Prober) Head(ctx context.Context, artifactURL string) (Presence, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, artifactURL, http.NoBody)
+	if err != nil {
+		return PresenceUnknown, 0, fmt.Errorf("cannot create request: %w", err)
+	}
+
+	resp, err := p.hc.Do(req)
+	if err != nil {
+		return PresenceUnknown, 0, fmt.Errorf("cannot HEAD %s: %w", artifactURL, err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			p.log.Warn(err)
+		}
+	}()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return PresenceAvailable, resp.StatusCode, nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return PresenceMissing, resp.StatusCode, nil
+	default:
+		return PresenceUnknown, resp.StatusCode, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+}
+
+// SHA256 downloads the artifact and returns its sha256 digest
+func (p *Prober) SHA256(ctx context.Context, artifactURL string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.downloadTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, artifactURL, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request: %w", err)
+	}
+
+	resp, err := p.hc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot GET %s: %w", artifactURL, err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			p.log.Warn(err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	h := sha256.New()
+
+	if _, err := io.Copy(h, resp.Body); err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", artifactURL, err)
+	}
+
+	return h.Sum(nil), nil
+}
@@ -7,9 +7,13 @@ import (
 
 	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/sourcefileproviders"
 	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/types"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/tracing"
 )
 
-func (s *Service) GetOriginal(ctx context.Context) (sourcefileproviders.FileMetadata, *types.SignedUpdateJSON, error) {
+func (s *Service) GetOriginal(ctx context.Context) (_ sourcefileproviders.FileMetadata, _ *types.SignedUpdateJSON, err error) {
+	ctx, span := tracing.Start(ctx, "GetOriginal")
+	defer func() { tracing.End(span, err) }()
+
 	ctx, cancel := context.WithTimeout(ctx, s.cfg.GetUpdateJSONBodyTimeout)
 	defer cancel()
 
@@ -21,7 +25,11 @@ func (s *Service) GetOriginal(ctx context.Context) (sourcefileproviders.FileMeta
 
 	signedJSON := &types.SignedUpdateJSON{}
 
-	if err := json.NewDecoder(r).Decode(signedJSON); err != nil {
+	_, decodeSpan := tracing.Start(ctx, "DecodeJSON")
+	err = json.NewDecoder(r).Decode(signedJSON)
+	tracing.End(decodeSpan, err)
+
+	if err != nil {
 		return sourcefileproviders.FileMetadata{}, nil, fmt.Errorf("cannot unmarshal json: %w", err)
 	}
 
@@ -0,0 +1,221 @@
+package patcher
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/mirror"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/types"
+)
+
+var (
+	_ types.Patcher            = (*MirrorFallbackService)(nil)
+	_ types.PatcherStats       = (*MirrorFallbackService)(nil)
+	_ types.DownloadURLPatcher = (*MirrorFallbackService)(nil)
+)
+
+// MirrorFallbackStats describes the last run of the mirror fallback patcher
+type MirrorFallbackStats struct {
+	Primary   string    `json:"primary"`
+	Fallbacks []string  `json:"fallbacks"`
+	LastRun   time.Time `json:"lastRun"`
+	Checked   int       `json:"checked"`
+	// Moved counts the artifacts by the base URL they are served from instead of the primary mirror
+	Moved          map[string]int `json:"moved"`
+	KnownAvailable int            `json:"knownAvailable"`
+}
+
+// MirrorFallbackService moves artifacts missing on the primary mirror to the first fallback mirror having them
+// or back to upstream. It is expected to run after Service has rewritten the download URLs.
+type MirrorFallbackService struct {
+	log *zap.SugaredLogger
+
+	prober      *mirror.Prober
+	concurrency int
+
+	origin, primary string
+	fallbacks       []string
+
+	mu sync.Mutex
+	// available holds the artifact URLs known to exist, artifacts are immutable so the positive results never expire
+	available map[string]struct{}
+
+	last *MirrorFallbackStats
+}
+
+func NewMirrorFallbackPatcher(log *zap.SugaredLogger, cfg config.PatchConfig) *MirrorFallbackService {
+	return &MirrorFallbackService{
+		log: log,
+
+		prober:      mirror.NewProber(log, cfg.AvailabilityTimeout, 0),
+		concurrency: cfg.AvailabilityConcurrency,
+
+		origin:    cfg.OriginDownloadURL,
+		primary:   cfg.NewDownloadURL,
+		fallbacks: cfg.FallbackDownloadURLs,
+
+		available: map[string]struct{}{},
+	}
+}
+
+// WithDownloadURL returns the patcher checking the artifacts on the mirror, the fallbacks and the prober are shared
+func (s *MirrorFallbackService) WithDownloadURL(downloadURL string) types.Patcher {
+	return &MirrorFallbackService{
+		log: s.log,
+
+		prober:      s.prober,
+		concurrency: s.concurrency,
+
+		origin:    s.origin,
+		primary:   downloadURL,
+		fallbacks: s.fallbacks,
+
+		available: map[string]struct{}{},
+	}
+}
+
+func (s *MirrorFallbackService) isAvailable(ctx context.Context, artifactURL string) bool {
+	s.mu.Lock()
+	_, ok := s.available[artifactURL]
+	s.mu.Unlock()
+
+	if ok {
+		return true
+	}
+
+	presence, _, err := s.prober.Head(ctx, artifactURL)
+	if err != nil {
+		s.log.Debugf("cannot check %s availability: %v", artifactURL, err)
+		return false
+	}
+
+	if presence != mirror.PresenceAvailable {
+		return false
+	}
+
+	s.mu.Lock()
+	s.available[artifactURL] = struct{}{}
+	s.mu.Unlock()
+
+	return true
+}
+
+// resolve returns the base URL the artifact should be downloaded from
+func (s *MirrorFallbackService) resolve(ctx context.Context, artifact mirror.Artifact) string {
+	if s.isAvailable(ctx, artifact.URL) {
+		return s.primary
+	}
+
+	artifactPath := strings.TrimPrefix(artifact.URL, s.primary)
+
+	for _, fallback := range s.fallbacks {
+		if s.isAvailable(ctx, fallback+artifactPath) {
+			return fallback
+		}
+	}
+
+	return s.origin
+}
+
+func (s *MirrorFallbackService) Name() string {
+	return "mirror-fallback"
+}
+
+func (s *MirrorFallbackService) Patch(ctx context.Context, insecureJSON *types.InsecureUpdateJSON) error {
+	var (
+		mu        sync.Mutex
+		artifacts = mirror.RewrittenArtifacts(insecureJSON, s.primary)
+		moved     = map[string]string{}
+	)
+
+	mirror.ForEach(ctx, artifacts, s.concurrency, func(ctx context.Context, artifact mirror.Artifact) {
+		base := s.resolve(ctx, artifact)
+		if base == s.primary {
+			return
+		}
+
+		mu.Lock()
+		moved[artifact.Name] = base
+		mu.Unlock()
+	})
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("artifacts availability check interrupted: %w", err)
+	}
+
+	for name, base := range moved {
+		if name == mirror.CoreArtifactName {
+			insecureJSON.Core.URL = base + strings.TrimPrefix(insecureJSON.Core.URL, s.primary)
+			continue
+		}
+
+		pluginInfo := insecureJSON.Plugins[name]
+		pluginInfo.URL = base + strings.TrimPrefix(pluginInfo.URL, s.primary)
+
+		insecureJSON.Plugins[name] = pluginInfo
+	}
+
+	if len(moved) > 0 {
+		insecureJSON.MirrorFallbacks = moved
+
+		s.log.Warnf("%d of %d artifacts are missing on %s and served from fallbacks", len(moved), len(artifacts), s.primary)
+	}
+
+	s.forgetStale(artifacts)
+
+	stats := &MirrorFallbackStats{
+		Primary:   s.primary,
+		Fallbacks: s.fallbacks,
+		LastRun:   time.Now(),
+		Checked:   len(artifacts),
+		Moved:     map[string]int{},
+	}
+
+	for _, base := range moved {
+		stats.Moved[base]++
+	}
+
+	s.mu.Lock()
+	stats.KnownAvailable = len(s.available)
+	s.last = stats
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Stats returns the outcome of the last run, nil before the first one
+func (s *MirrorFallbackService) Stats() any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.last
+}
+
+// forgetStale drops the cached results for the artifacts no longer present in the feed
+func (s *MirrorFallbackService) forgetStale(artifacts []mirror.Artifact) {
+	current := make(map[string]struct{}, len(artifacts)*(len(s.fallbacks)+1))
+
+	for _, artifact := range artifacts {
+		artifactPath := strings.TrimPrefix(artifact.URL, s.primary)
+
+		current[artifact.URL] = struct{}{}
+		for _, fallback := range s.fallbacks {
+			current[fallback+artifactPath] = struct{}{}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for artifactURL := range s.available {
+		if _, ok := current[artifactURL]; !ok {
+			delete(s.available, artifactURL)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package patcher
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/types"
+)
+
+func newMirror(paths ...string) *httptest.Server {
+	available := map[string]struct{}{}
+	for _, p := range paths {
+		available[p] = struct{}{}
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := available[r.URL.Path]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestMirrorFallbackPatcher(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+
+	originURL := "https://updates.jenkins.io/download"
+
+	primary := newMirror("/plugins/a/1.0/a.hpi", "/war/2.472/jenkins.war")
+	defer primary.Close()
+
+	fallback := newMirror("/plugins/a/1.0/a.hpi", "/plugins/b/1.0/b.hpi")
+	defer fallback.Close()
+
+	document := func() *types.InsecureUpdateJSON {
+		return &types.InsecureUpdateJSON{
+			Core: types.Core{
+				URL: originURL + "/war/2.472/jenkins.war",
+			},
+			Plugins: map[string]types.Plugin{
+				"a": {URL: originURL + "/plugins/a/1.0/a.hpi"},
+				"b": {URL: originURL + "/plugins/b/1.0/b.hpi"},
+				"c": {URL: originURL + "/plugins/c/1.0/c.hpi"},
+			},
+		}
+	}
+
+	origin := document()
+
+	cfg := config.PatchConfig{
+		OriginDownloadURL:       originURL,
+		NewDownloadURL:          primary.URL,
+		FallbackDownloadURLs:    []string{fallback.URL},
+		AvailabilityTimeout:     5 * time.Second,
+		AvailabilityConcurrency: 2,
+	}
+
+	patchers := []types.Patcher{NewPatcher(logger.Sugar(), cfg), NewMirrorFallbackPatcher(logger.Sugar(), cfg)}
+
+	for _, p := range patchers {
+		if err := p.Patch(context.Background(), origin); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := map[string]string{
+		"a": primary.URL + "/plugins/a/1.0/a.hpi",
+		"b": fallback.URL + "/plugins/b/1.0/b.hpi",
+		"c": originURL + "/plugins/c/1.0/c.hpi",
+	}
+
+	for name, u := range expected {
+		if origin.Plugins[name].URL != u {
+			t.Fatalf("plugin %s URL is %s, expected %s", name, origin.Plugins[name].URL, u)
+		}
+	}
+
+	if origin.Core.URL != primary.URL+"/war/2.472/jenkins.war" {
+		t.Fatalf("core URL is %s", origin.Core.URL)
+	}
+
+	if len(origin.MirrorFallbacks) != 2 || origin.MirrorFallbacks["b"] != fallback.URL || origin.MirrorFallbacks["c"] != originURL {
+		t.Fatalf("unexpected fallbacks recorded: %v", origin.MirrorFallbacks)
+	}
+
+	// the same chain pointed to another mirror checks the artifacts there
+	profile := newMirror("/plugins/c/1.0/c.hpi", "/war/2.472/jenkins.war")
+	defer profile.Close()
+
+	variant := document()
+
+	for _, p := range patchers {
+		if err := p.(types.DownloadURLPatcher).WithDownloadURL(profile.URL).Patch(context.Background(), variant); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if variant.Plugins["c"].URL != profile.URL+"/plugins/c/1.0/c.hpi" ||
+		len(variant.MirrorFallbacks) != 2 || variant.MirrorFallbacks["a"] != fallback.URL || variant.MirrorFallbacks["b"] != fallback.URL {
+		t.Fatalf("unexpected variant fallbacks recorded: %v", variant.MirrorFallbacks)
+	}
+
+	if stats := patchers[0].(types.PatcherStats).Stats().(*DownloadURLStats); stats.To != primary.URL {
+		t.Fatalf("retargeted patcher reported its run as the configured one: %+v", stats)
+	}
+}
@@ -1,7 +1,10 @@
 package patcher
 
 import (
+	"context"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -10,13 +13,26 @@ import (
 )
 
 var (
-	_ types.Patcher = Service{}
+	_ types.Patcher            = Service{}
+	_ types.PatcherStats       = Service{}
+	_ types.DownloadURLPatcher = Service{}
 )
 
+// DownloadURLStats describes the last run of the download URL patcher
+type DownloadURLStats struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	LastRun   time.Time `json:"lastRun"`
+	Rewritten int       `json:"rewritten"`
+	Total     int       `json:"total"`
+}
+
 type Service struct {
 	log *zap.SugaredLogger
 
 	from, to string
+
+	last *atomic.Pointer[DownloadURLStats]
 }
 
 func NewPatcher(log *zap.SugaredLogger, cfg config.PatchConfig) Service {
@@ -25,19 +41,51 @@ func NewPatcher(log *zap.SugaredLogger, cfg config.PatchConfig) Service {
 
 		from: cfg.OriginDownloadURL,
 		to:   cfg.NewDownloadURL,
+
+		last: &atomic.Pointer[DownloadURLStats]{},
 	}
 }
 
-func (s Service) Patch(insecureJSON *types.InsecureUpdateJSON) error {
+func (s Service) WithDownloadURL(downloadURL string) types.Patcher {
+	return Service{
+		log: s.log,
+
+		from: s.from,
+		to:   downloadURL,
+
+		last: &atomic.Pointer[DownloadURLStats]{},
+	}
+}
+
+func (s Service) Name() string {
+	return "download-url"
+}
+
+func (s Service) Patch(_ context.Context, insecureJSON *types.InsecureUpdateJSON) error {
+	stats := &DownloadURLStats{From: s.from, To: s.to, LastRun: time.Now(), Total: len(insecureJSON.Plugins) + 1}
+
 	// Patch URL in Core section
-	insecureJSON.Core.URL = strings.ReplaceAll(insecureJSON.Core.URL, s.from, s.to)
+	if strings.Contains(insecureJSON.Core.URL, s.from) {
+		insecureJSON.Core.URL = strings.ReplaceAll(insecureJSON.Core.URL, s.from, s.to)
+		stats.Rewritten++
+	}
 
 	// and plugins download URLs
 	for pluginName, pluginInfo := range insecureJSON.Plugins {
-		pluginInfo.URL = strings.ReplaceAll(insecureJSON.Plugins[pluginName].URL, s.from, s.to)
+		if strings.Contains(pluginInfo.URL, s.from) {
+			pluginInfo.URL = strings.ReplaceAll(pluginInfo.URL, s.from, s.to)
+			stats.Rewritten++
+		}
 
 		insecureJSON.Plugins[pluginName] = pluginInfo
 	}
 
+	s.last.Store(stats)
+
 	return nil
 }
+
+// Stats returns the outcome of the last run, nil before the first one
+func (s Service) Stats() any {
+	return s.last.Load()
+}
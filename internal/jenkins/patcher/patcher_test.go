@@ -1,6 +1,7 @@
 package patcher
 
 import (
+	"context"
 	"strings"
 	"testing"
 
@@ -30,7 +31,7 @@ func TestPatcher(t *testing.T) {
 		NewDownloadURL:    patchedURL,
 	})
 
-	if err := p.Patch(origin); err != nil {
+	if err := p.Patch(context.Background(), origin); err != nil {
 		t.Fatal(err)
 	}
 
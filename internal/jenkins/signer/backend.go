@@ -0,0 +1,32 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/x509"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+)
+
+// keyBackend provides the private keys kept outside of the process memory
+type keyBackend interface {
+	// Signer returns the key referenced by keyRef, the certificate is the one issued for it
+	Signer(keyRef string, cert *x509.Certificate) (crypto.Signer, error)
+	// Close releases the backend, the keys it returned are no longer usable
+	Close() error
+}
+
+func (s *Service) newKeyBackend() (keyBackend, error) {
+	switch s.cfg.Backend {
+	case config.SignerBackendPKCS11:
+		pin, err := s.keyPassword()
+		if err != nil {
+			return nil, err
+		}
+
+		return newPKCS11Backend(s.log, s.cfg, pin)
+	case config.SignerBackendCommand:
+		return newCommandBackend(s.log, s.cfg), nil
+	default:
+		return nil, nil
+	}
+}
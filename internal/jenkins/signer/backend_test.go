@@ -0,0 +1,99 @@
+package signer
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+)
+
+// TestSignCommandHelper is the signing command run by the command backend tests
+func TestSignCommandHelper(t *testing.T) {
+	if os.Getenv("GO_WANT_SIGN_COMMAND_HELPER") != "1" {
+		return
+	}
+
+	hashes := map[string]crypto.Hash{"SHA-1": crypto.SHA1, "SHA-512": crypto.SHA512}
+
+	keyPEM, err := os.ReadFile(os.Getenv("SIGN_KEY"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := pem.Decode(keyPEM)
+
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature, err := key.Sign(rand.Reader, digest, hashes[os.Getenv("SIGN_DIGEST_ALGORITHM")])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _ = os.Stdout.Write(signature)
+	os.Exit(0)
+}
+
+func TestCommandBackend(t *testing.T) {
+	c := newTestCert(t, "Command", false, x509.KeyUsageDigitalSignature, time.Now().Add(time.Hour), nil)
+	other := newTestCert(t, "Other", false, x509.KeyUsageDigitalSignature, time.Now().Add(time.Hour), nil)
+
+	dir := t.TempDir()
+	certPath, keyPath := c.writePEM(t, dir, "command")
+	_, otherKeyPath := other.writePEM(t, dir, "other")
+
+	t.Setenv("GO_WANT_SIGN_COMMAND_HELPER", "1")
+
+	cfg := config.SignerConfig{
+		Backend:            config.SignerBackendCommand,
+		CertificatePath:    certPath,
+		KeyPath:            keyPath,
+		SignCommand:        os.Args[0],
+		SignCommandArgs:    []string{"-test.run=^TestSignCommandHelper$"},
+		SignCommandTimeout: time.Minute,
+	}
+
+	command, err := NewSignerService(log, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := NewSignerService(log, config.SignerConfig{CertificatePath: certPath, KeyPath: keyPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := file.GetSignature(context.Background(), unsigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature, err := command.GetSignature(context.Background(), unsigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(signature, expected) {
+		t.Fatal("command backend signature differs from the file backend one")
+	}
+
+	cfg.KeyPath = otherKeyPath
+	if _, err := NewSignerService(log, cfg); err == nil {
+		t.Fatal("command signing with a key not matching the certificate is accepted")
+	}
+}
@@ -0,0 +1,100 @@
+package signer
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+)
+
+var (
+	_ keyBackend    = (*commandBackend)(nil)
+	_ crypto.Signer = (*commandKey)(nil)
+
+	digestAlgorithms = map[crypto.Hash]string{
+		crypto.SHA1:   "SHA-1",
+		crypto.SHA256: "SHA-256",
+		crypto.SHA512: "SHA-512",
+	}
+)
+
+// commandBackend delegates signing to an external command: the digest is written to its stdin, the algorithm
+// is passed in SIGN_DIGEST_ALGORITHM and the key reference in SIGN_KEY, the PKCS#1 v1.5 signature is read from stdout
+type commandBackend struct {
+	log     *zap.SugaredLogger
+	command string
+	args    []string
+	timeout time.Duration
+}
+
+func newCommandBackend(log *zap.SugaredLogger, cfg config.SignerConfig) *commandBackend {
+	return &commandBackend{
+		log:     log,
+		command: cfg.SignCommand,
+		args:    cfg.SignCommandArgs,
+		timeout: cfg.SignCommandTimeout,
+	}
+}
+
+func (b *commandBackend) Close() error {
+	return nil
+}
+
+func (b *commandBackend) Signer(keyRef string, cert *x509.Certificate) (crypto.Signer, error) {
+	b.log.Infof("Signing with %s command for certificate %q", b.command, cert.Subject)
+
+	return &commandKey{
+		backend: b,
+		keyRef:  keyRef,
+		public:  cert.PublicKey,
+	}, nil
+}
+
+type commandKey struct {
+	backend *commandBackend
+	keyRef  string
+	public  crypto.PublicKey
+}
+
+func (k *commandKey) Public() crypto.PublicKey {
+	return k.public
+}
+
+func (k *commandKey) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	algorithm, ok := digestAlgorithms[opts.HashFunc()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported digest algorithm %s", opts.HashFunc())
+	}
+
+	ctx := context.Background()
+	if k.backend.timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, k.backend.timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, k.backend.command, k.backend.args...) //nolint:gosec
+	cmd.Env = append(os.Environ(), "SIGN_DIGEST_ALGORITHM="+algorithm, "SIGN_KEY="+k.keyRef)
+	cmd.Stdin = bytes.NewReader(digest)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("signing command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
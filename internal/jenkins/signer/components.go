@@ -32,13 +32,18 @@ func (sc JSONSignatureComponents) GetSignature1() string {
 	return base64.StdEncoding.EncodeToString(sc.signature1)
 }
 
-func (sc JSONSignatureComponents) GetCertificates(_ x509.CertPool, cert *x509.Certificate) []string {
-	return []string{base64.StdEncoding.EncodeToString(cert.Raw)}
+func (sc JSONSignatureComponents) GetCertificates(chain []*x509.Certificate) []string {
+	certs := make([]string, 0, len(chain))
+	for _, cert := range chain {
+		certs = append(certs, base64.StdEncoding.EncodeToString(cert.Raw))
+	}
+
+	return certs
 }
 
-func (sc JSONSignatureComponents) GetSignatureObject(roots x509.CertPool, cert *x509.Certificate) types.Signature {
+func (sc JSONSignatureComponents) GetSignatureObject(chain []*x509.Certificate) types.Signature {
 	return types.Signature{
-		Certificates:        sc.GetCertificates(roots, cert),
+		Certificates:        sc.GetCertificates(chain),
 		CorrectDigest:       sc.GetDigest1(),
 		CorrectDigest512:    sc.GetDigest512(),
 		CorrectSignature:    sc.GetSignature1(),
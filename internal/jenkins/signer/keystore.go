@@ -0,0 +1,69 @@
+package signer
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/keystore"
+)
+
+// parseKeystore loads the private key and its certificate chain from a JKS, JCEKS or PKCS#12 keystore, a JKS or
+// JCEKS keystore is opened with the key password when storePassword is empty
+func (s *Service) parseKeystore(keystorePath, alias, storePassword, password string) (*x509.Certificate, *rsa.PrivateKey, []*x509.Certificate, error) {
+	data, err := os.ReadFile(keystorePath) //nolint:gosec
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("cannot read keystore %s: %w", keystorePath, err)
+	}
+
+	var (
+		pkeyIf interface{}
+		chain  []*x509.Certificate
+	)
+
+	if keystore.IsKeyStore(data) {
+		if storePassword == "" {
+			storePassword = password
+		}
+
+		ks, err := keystore.Decode(data, storePassword)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("cannot decode keystore %s: %w", keystorePath, err)
+		}
+
+		if pkeyIf, chain, err = ks.PrivateKey(alias, password); err != nil {
+			return nil, nil, nil, err
+		}
+	} else {
+		if alias != "" {
+			s.log.Warnf("keystore alias is ignored for PKCS#12 keystore %s", keystorePath)
+		}
+
+		var (
+			cert    *x509.Certificate
+			caCerts []*x509.Certificate
+		)
+
+		if pkeyIf, cert, caCerts, err = pkcs12.DecodeChain(data, password); err != nil {
+			return nil, nil, nil, fmt.Errorf("cannot decode PKCS#12 keystore %s: %w", keystorePath, err)
+		}
+
+		chain = append([]*x509.Certificate{cert}, caCerts...)
+	}
+
+	if len(chain) == 0 {
+		return nil, nil, nil, fmt.Errorf("keystore %s has no certificate for the private key", keystorePath)
+	}
+
+	priv, ok := pkeyIf.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("keystore %s private key is not an RSA one", keystorePath)
+	}
+
+	s.log.Infof("Private key and %d certificates loaded from keystore %s", len(chain), keystorePath)
+
+	return chain[0], priv, chain[1:], nil
+}
@@ -0,0 +1,89 @@
+package signer
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/keystore"
+)
+
+func TestKeystores(t *testing.T) {
+	pki := newTestPKI(t)
+	other := newTestPKI(t)
+
+	dir := t.TempDir()
+
+	passwordPath := filepath.Join(dir, "password")
+	if err := os.WriteFile(passwordPath, []byte("changeit\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p12, err := pkcs12.Modern.Encode(pki.leaf.key, pki.leaf.cert, []*x509.Certificate{pki.intermediate.cert}, "changeit")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks := keystore.New()
+	for alias, c := range map[string]testCert{"signer": pki.leaf, "other": other.leaf} {
+		if err := ks.SetPrivateKey(alias, c.key, []*x509.Certificate{c.cert, pki.intermediate.cert}, "changeit"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the keystore password differs from the key one
+	var jks bytes.Buffer
+	if err := ks.Encode(&jks, "storepass"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		base64.StdEncoding.EncodeToString(pki.leaf.cert.Raw),
+		base64.StdEncoding.EncodeToString(pki.intermediate.cert.Raw),
+	}
+
+	for name, test := range map[string]struct {
+		data      []byte
+		storePass string
+	}{
+		"signer.p12": {data: p12},
+		"signer.jks": {data: jks.Bytes(), storePass: "storepass"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			keystorePath := filepath.Join(dir, name)
+			if err := os.WriteFile(keystorePath, test.data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := NewSignerService(log, config.SignerConfig{
+				KeystorePath:    keystorePath,
+				KeystoreAlias:   "signer",
+				KeystorePass:    test.storePass,
+				KeyPasswordFile: passwordPath,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(s.SigningCertificates(), expected) {
+				t.Fatal("signature certificates are not leaf and intermediate ones")
+			}
+
+			if _, err := NewSignerService(log, config.SignerConfig{
+				KeystorePath:  keystorePath,
+				KeystoreAlias: "signer",
+				KeystorePass:  test.storePass,
+				KeyPassword:   "wrong",
+			}); err == nil {
+				t.Fatal("wrong keystore password is accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package signer
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+type CertificateInfo struct {
+	Subject           string    `json:"subject"`
+	Issuer            string    `json:"issuer"`
+	SerialNumber      string    `json:"serialNumber"`
+	FingerprintSHA256 string    `json:"fingerprintSha256"`
+	NotBefore         time.Time `json:"notBefore"`
+	NotAfter          time.Time `json:"notAfter"`
+	DaysUntilExpiry   int       `json:"daysUntilExpiry"`
+	Expired           bool      `json:"expired"`
+	ChainLength       int       `json:"chainLength"`
+}
+
+func certificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func isCertificateValidAt(cert *x509.Certificate, now time.Time) bool {
+	return !now.Before(cert.NotBefore) && !now.After(cert.NotAfter)
+}
+
+// validateSigningMaterial checks the private key matches the certificate which is currently valid and allows digital signatures
+func validateSigningMaterial(cert *x509.Certificate, key crypto.Signer, now time.Time) error {
+	pub, ok := key.Public().(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("private key is not an RSA one")
+	}
+
+	if !pub.Equal(cert.PublicKey) {
+		return fmt.Errorf("private key does not match certificate %q", cert.Subject)
+	}
+
+	if now.Before(cert.NotBefore) {
+		return fmt.Errorf("certificate %q is not valid before %s", cert.Subject, cert.NotBefore)
+	}
+
+	if now.After(cert.NotAfter) {
+		return fmt.Errorf("certificate %q expired at %s", cert.Subject, cert.NotAfter)
+	}
+
+	if cert.KeyUsage != 0 && cert.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return fmt.Errorf("certificate %q key usage does not allow digital signatures", cert.Subject)
+	}
+
+	// the key may be kept outside, make sure it actually signs for the certificate
+	digest := sha512.Sum512([]byte(cert.Subject.String()))
+
+	probe, err := key.Sign(rand.Reader, digest[:], crypto.SHA512)
+	if err != nil {
+		return fmt.Errorf("cannot sign with private key: %w", err)
+	}
+
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA512, digest[:], probe); err != nil {
+		return fmt.Errorf("private key signature is not verified by certificate %q: %w", cert.Subject, err)
+	}
+
+	return nil
+}
+
+func (s *Service) CertificateInfo() CertificateInfo {
+	var (
+		m   = s.active()
+		now = time.Now()
+	)
+
+	return CertificateInfo{
+		Subject:           m.cert.Subject.String(),
+		Issuer:            m.cert.Issuer.String(),
+		SerialNumber:      m.cert.SerialNumber.String(),
+		FingerprintSHA256: certificateFingerprint(m.cert),
+		NotBefore:         m.cert.NotBefore,
+		NotAfter:          m.cert.NotAfter,
+		DaysUntilExpiry:   int(math.Floor(m.cert.NotAfter.Sub(now).Hours() / 24)),
+		Expired:           !isCertificateValidAt(m.cert, now),
+		ChainLength:       len(m.chain),
+	}
+}
+
+// checkExpiry warns once per crossed threshold and returns the smallest one crossed so far
+func (s *Service) checkExpiry(now time.Time, warned time.Duration) time.Duration {
+	m := s.active()
+
+	remaining := m.cert.NotAfter.Sub(now)
+
+	if remaining <= 0 {
+		s.log.Errorf("signing certificate %q expired at %s", m.cert.Subject, m.cert.NotAfter)
+		return 0
+	}
+
+	thresholds := append([]time.Duration(nil), s.cfg.ExpiryWarnThresholds...)
+	sort.Slice(thresholds, func(i, j int) bool {
+		return thresholds[i] < thresholds[j]
+	})
+
+	for _, threshold := range thresholds {
+		if remaining > threshold {
+			continue
+		}
+
+		if warned == 0 || threshold < warned {
+			s.log.Warnf("signing certificate %q expires in %d days (%s)", m.cert.Subject, int(remaining.Hours()/24), m.cert.NotAfter)
+		}
+
+		return threshold
+	}
+
+	return warned
+}
+
+func (s *Service) RunExpiryMonitor(ctx context.Context) {
+	s.log.Infow("starting certificate expiry monitor")
+	defer s.log.Infow("certificate expiry monitor stopped")
+
+	var (
+		fingerprint = certificateFingerprint(s.active().cert)
+		warned      = s.checkExpiry(time.Now(), 0)
+	)
+
+	if s.cfg.ExpiryCheckInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.cfg.ExpiryCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// the signing material has been reloaded or rolled over, the thresholds apply to the new certificate
+			if current := certificateFingerprint(s.active().cert); current != fingerprint {
+				fingerprint, warned = current, 0
+			}
+
+			warned = s.checkExpiry(time.Now(), warned)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package signer
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+)
+
+func TestSigningMaterialValidation(t *testing.T) {
+	pki := newTestPKI(t)
+
+	expired := newTestCert(t, "Expired", false, x509.KeyUsageDigitalSignature, time.Now().Add(-time.Minute), nil)
+	caOnly := newTestCert(t, "CA only", true, x509.KeyUsageCertSign, time.Now().Add(time.Hour), nil)
+
+	cases := map[string]struct {
+		cert testCert
+		key  testCert
+	}{
+		"mismatched-key":       {cert: pki.leaf, key: pki.root},
+		"expired":              {cert: expired, key: expired},
+		"no-digital-signature": {cert: caOnly, key: caOnly},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			certPath, _ := test.cert.writePEM(t, dir, "cert")
+			_, keyPath := test.key.writePEM(t, dir, "key")
+
+			if _, err := NewSignerService(log, config.SignerConfig{
+				CertificatePath: certPath,
+				KeyPath:         keyPath,
+			}); err == nil {
+				t.Fatal("invalid signing material accepted")
+			} else {
+				t.Logf("invalid signing material detected: %v", err)
+			}
+		})
+	}
+}
+
+func TestRefuseExpired(t *testing.T) {
+	expired := newTestCert(t, "Expired", false, x509.KeyUsageDigitalSignature, time.Now().Add(-time.Minute), nil)
+
+	s := &Service{
+		log:       log,
+		cfg:       config.SignerConfig{RefuseExpired: true},
+		materials: materials{current: expired.material()},
+	}
+
+	if _, err := s.GetSignature(context.Background(), unsigned); err == nil {
+		t.Fatal("signature made with expired certificate")
+	}
+
+	if !s.CertificateInfo().Expired {
+		t.Fatal("certificate is not reported as expired")
+	}
+}
+
+func TestCheckExpiry(t *testing.T) {
+	c := newTestCert(t, "Expiring", false, x509.KeyUsageDigitalSignature, time.Now().Add(100*time.Hour), nil)
+
+	s := &Service{
+		log:       log,
+		cfg:       config.SignerConfig{ExpiryWarnThresholds: []time.Duration{24 * time.Hour, 720 * time.Hour, 168 * time.Hour}},
+		materials: materials{current: c.material()},
+	}
+
+	if warned := s.checkExpiry(time.Now(), 0); warned != 168*time.Hour {
+		t.Fatalf("unexpected threshold crossed: %s", warned)
+	}
+
+	if warned := s.checkExpiry(time.Now().Add(90*time.Hour), 168*time.Hour); warned != 24*time.Hour {
+		t.Fatalf("unexpected threshold crossed: %s", warned)
+	}
+}
@@ -1,32 +1,144 @@
 package signer
 
 import (
+	"bytes"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
-	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/keystore"
 )
 
-func (s *Service) parseSignerParameters(cfg config.SignerConfig) error {
-	var err error
+// materialSource points to the files holding the signing certificate and private key
+type materialSource struct {
+	certPath, keyPath, keystorePath string
+}
 
-	if s.roots, err = s.parseCACertificates(cfg.CAPath); err != nil {
-		return fmt.Errorf("cannot parse CA certificates: %w", err)
+// loadMaterial reads and validates the certificate and private key, the certificate must be valid at the activation time
+func (s *Service) loadMaterial(source materialSource, activation time.Time) (*material, error) {
+	caCerts, err := s.parseCACertificates(s.cfg.CAPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse CA certificates: %w", err)
 	}
 
-	if s.cert, err = s.parseCertificate(cfg.CertificatePath); err != nil {
-		return fmt.Errorf("cannot parse certificate: %w", err)
+	password, err := s.keyPassword()
+	if err != nil {
+		return nil, err
 	}
 
-	if s.priv, err = s.parsePrivateKey(cfg.KeyPath, cfg.KeyPassword); err != nil {
-		return fmt.Errorf("cannot parse private key: %w", err)
+	m := &material{}
+
+	switch {
+	case s.backend != nil:
+		if m.cert, err = s.parseCertificate(source.certPath); err != nil {
+			return nil, fmt.Errorf("cannot parse certificate: %w", err)
+		}
+
+		if m.key, err = s.backend.Signer(source.keyPath, m.cert); err != nil {
+			return nil, fmt.Errorf("cannot get private key %q: %w", source.keyPath, err)
+		}
+	case source.keystorePath != "":
+		var chain []*x509.Certificate
 
+		if m.cert, m.key, chain, err = s.parseKeystore(source.keystorePath, s.cfg.KeystoreAlias, s.cfg.KeystorePass, password); err != nil {
+			return nil, fmt.Errorf("cannot load keystore: %w", err)
+		}
+
+		caCerts = append(caCerts, chain...)
+	default:
+		if m.cert, err = s.parseCertificate(source.certPath); err != nil {
+			return nil, fmt.Errorf("cannot parse certificate: %w", err)
+		}
+
+		if m.key, err = s.parsePrivateKey(source.keyPath, password); err != nil {
+			return nil, fmt.Errorf("cannot parse private key: %w", err)
+		}
 	}
 
-	return nil
+	if m.chain, m.root, err = s.buildChain(m.cert, caCerts); err != nil {
+		return nil, fmt.Errorf("cannot build certificate chain: %w", err)
+	}
+
+	if err := validateSigningMaterial(m.cert, m.key, activation); err != nil {
+		return nil, fmt.Errorf("invalid signing material: %w", err)
+	}
+
+	return m, nil
+}
+
+// keyPassword returns the configured password or the one read from the password file
+func (s *Service) keyPassword() (string, error) {
+	if s.cfg.KeyPasswordFile == "" {
+		return s.cfg.KeyPassword, nil
+	}
+
+	password, err := os.ReadFile(s.cfg.KeyPasswordFile) //nolint:gosec
+	if err != nil {
+		return "", fmt.Errorf("cannot read password file: %w", err)
+	}
+
+	return strings.TrimRight(string(password), "\r\n"), nil
+}
+
+// loadMaterials loads the current signing material and the staged next one when it is configured
+func (s *Service) loadMaterials() (materials, error) {
+	var (
+		ms  materials
+		err error
+	)
+
+	current := materialSource{
+		certPath:     s.cfg.CertificatePath,
+		keyPath:      s.cfg.KeyPath,
+		keystorePath: s.cfg.KeystorePath,
+	}
+
+	if s.cfg.NextCertificatePath == "" && s.cfg.NextKeystorePath == "" {
+		if ms.current, err = s.loadMaterial(current, time.Now()); err != nil {
+			return materials{}, err
+		}
+
+		return ms, nil
+	}
+
+	if ms.nextActivation, err = time.Parse(time.RFC3339, s.cfg.NextActivationTime); err != nil {
+		return materials{}, fmt.Errorf("cannot parse next activation time: %w", err)
+	}
+
+	// the activated next material signs from now on and is validated at the moment
+	validAt := ms.nextActivation
+	if now := time.Now(); !now.Before(validAt) {
+		validAt = now
+	}
+
+	if ms.next, err = s.loadMaterial(materialSource{
+		certPath:     s.cfg.NextCertificatePath,
+		keyPath:      s.cfg.NextKeyPath,
+		keystorePath: s.cfg.NextKeystorePath,
+	}, validAt); err != nil {
+		return materials{}, fmt.Errorf("next signing material: %w", err)
+	}
+
+	if ms.current, err = s.loadMaterial(current, time.Now()); err != nil {
+		if time.Now().Before(ms.nextActivation) {
+			return materials{}, err
+		}
+
+		// the current material is not used after the rollover, so it may expire or be removed
+		s.log.Warnf("current signing material is replaced by the activated next one: %v", err)
+
+		ms.current, ms.next = ms.next, nil
+
+		return ms, nil
+	}
+
+	s.log.Infof("next certificate %q is staged for activation at %s", ms.next.cert.Subject, ms.nextActivation)
+
+	return ms, nil
 }
 
 func (s *Service) parseCertificate(certPath string) (*x509.Certificate, error) {
@@ -55,21 +167,98 @@ func (s *Service) parseCertificate(certPath string) (*x509.Certificate, error) {
 	return cert, nil
 }
 
-func (s *Service) parseCACertificates(caPath string) (x509.CertPool, error) {
-	var roots x509.CertPool
+func (s *Service) parseCACertificates(caPath string) ([]*x509.Certificate, error) {
+	if caPath == "" {
+		return nil, nil
+	}
 
-	if caPath != "" {
-		pemBytes, err := os.ReadFile(caPath) //nolint:gosec
-		if err != nil {
-			return x509.CertPool{}, fmt.Errorf("cannot load CA certificates from %s: %w", caPath, err)
+	pemBytes, err := os.ReadFile(caPath) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("cannot load CA certificates from %s: %w", caPath, err)
+	}
+
+	caCerts, err := parseCertificates(pemBytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse CA certificates from %s: %w", caPath, err)
+	}
+
+	s.log.Infof("%d CA certificates imported from %s", len(caCerts), caPath)
+
+	return caCerts, nil
+}
+
+// isSelfSigned checks the certificate is signed by its own key, the self-signed signing certificates without the CA
+// flag are roots too
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) &&
+		cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// buildChain validates the certificate against the CA bundle and returns the certificates to embed into signatures:
+// the certificate itself followed by the intermediates, and the root expected to be in Jenkins update-center-rootCAs,
+// nil when the chain does not end with a self-signed certificate, the root is not published then
+func (s *Service) buildChain(cert *x509.Certificate, caCerts []*x509.Certificate) ([]*x509.Certificate, *x509.Certificate, error) {
+	if len(caCerts) == 0 {
+		return []*x509.Certificate{cert}, s.selfSignedRoot(cert), nil
+	}
+
+	var (
+		roots, intermediates = x509.NewCertPool(), x509.NewCertPool()
+		hasRoots             bool
+	)
+
+	for _, caCert := range caCerts {
+		if isSelfSigned(caCert) {
+			roots.AddCert(caCert)
+			hasRoots = true
+		} else {
+			intermediates.AddCert(caCert)
 		}
+	}
 
-		roots.AppendCertsFromPEM(pemBytes)
+	// the bundle may hold intermediates only, the topmost one becomes the anchor then
+	if !hasRoots {
+		for _, caCert := range caCerts {
+			roots.AddCert(caCert)
+		}
+	}
+
+	chains, err := cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("certificate is not issued by the configured CA: %w", err)
+	}
+
+	chain := []*x509.Certificate{cert}
+
+	for _, caCert := range chains[0][1:] {
+		if isSelfSigned(caCert) {
+			continue
+		}
+
+		chain = append(chain, caCert)
+	}
 
-		s.log.Info("CA certificates imported from ", caPath)
+	for _, c := range chain {
+		s.log.Infof("Certificate %q issued by %q is embedded into signatures", c.Subject, c.Issuer)
 	}
 
-	return roots, nil
+	return chain, s.selfSignedRoot(chains[0][len(chains[0])-1]), nil
+}
+
+// selfSignedRoot returns the chain anchor when it is a root CA
+func (s *Service) selfSignedRoot(anchor *x509.Certificate) *x509.Certificate {
+	if isSelfSigned(anchor) {
+		return anchor
+	}
+
+	s.log.Warnf("certificate chain ends with %q issued by %q, which is not a root CA: no root CA is published, "+
+		"add the root to the CA bundle", anchor.Subject, anchor.Issuer)
+
+	return nil
 }
 
 func (s *Service) parsePrivateKey(privPath, privEncPassword string) (*rsa.PrivateKey, error) {
@@ -82,33 +271,51 @@ func (s *Service) parsePrivateKey(privPath, privEncPassword string) (*rsa.Privat
 		return nil, fmt.Errorf("cannot load certificates from %s: %w", privPath, err)
 	}
 	pemBlock, _ := pem.Decode(pemBytes)
+	if pemBlock == nil {
+		return nil, fmt.Errorf("failed to parse private key PEM")
+	}
+
+	var (
+		pkeyIf interface{}
+	)
+
+	switch {
+	case pemBlock.Type == "ENCRYPTED PRIVATE KEY":
+		if pkeyIf, err = keystore.DecryptPKCS8PrivateKey(pemBlock.Bytes, privEncPassword); err != nil {
+			return nil, fmt.Errorf("cannot decrypt private key from %s: %w", privPath, err)
+		}
+	case x509.IsEncryptedPEMBlock(pemBlock): //nolint:staticcheck
+		s.log.Warnf("private key %s is encrypted with the insecure legacy PEM encryption, consider converting it to encrypted PKCS#8", privPath)
 
-	if privEncPassword != "" {
 		//nolint:staticcheck
 		pemBytes, err = x509.DecryptPEMBlock(pemBlock, []byte(privEncPassword))
 		if err != nil {
 			return nil, err
 		}
-	} else {
-		pemBytes = pemBlock.Bytes
-	}
-
-	var (
-		pkeyIf interface{}
-	)
 
-	if pkeyIf, err = x509.ParsePKCS1PrivateKey(pemBytes); err != nil {
-		if pkeyIf, err = x509.ParsePKCS8PrivateKey(pemBytes); err != nil { // note this returns type `interface{}`
+		if pkeyIf, err = parseUnencryptedPrivateKey(pemBytes); err != nil {
+			return nil, fmt.Errorf("cannot load private key from %s: %w", privPath, err)
+		}
+	default:
+		if pkeyIf, err = parseUnencryptedPrivateKey(pemBlock.Bytes); err != nil {
 			return nil, fmt.Errorf("cannot load private key from %s: %w", privPath, err)
 		}
 	}
 
 	priv, ok := pkeyIf.(*rsa.PrivateKey)
 	if !ok {
-		return nil, fmt.Errorf("cannot cast private key: %w", err)
+		return nil, fmt.Errorf("private key %s is not an RSA one", privPath)
 	}
 
 	s.log.Infof("Loaded private key loaded from %s", privPath)
 
 	return priv, nil
 }
+
+func parseUnencryptedPrivateKey(der []byte) (interface{}, error) {
+	if priv, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return priv, nil
+	}
+
+	return x509.ParsePKCS8PrivateKey(der) // note this returns type `interface{}`
+}
@@ -0,0 +1,61 @@
+//go:build cgo
+
+package signer
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/ThalesIgnite/crypto11"
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+)
+
+var (
+	_ keyBackend = (*pkcs11Backend)(nil)
+)
+
+// pkcs11Backend finds the private keys by label on a PKCS#11 token, the key never leaves the token
+type pkcs11Backend struct {
+	log *zap.SugaredLogger
+	ctx *crypto11.Context
+}
+
+func newPKCS11Backend(log *zap.SugaredLogger, cfg config.SignerConfig, pin string) (keyBackend, error) {
+	ctx, err := crypto11.Configure(&crypto11.Config{
+		Path:       cfg.PKCS11ModulePath,
+		TokenLabel: cfg.PKCS11TokenLabel,
+		Pin:        pin,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot open PKCS#11 token %q: %w", cfg.PKCS11TokenLabel, err)
+	}
+
+	log.Infof("PKCS#11 token %q opened with %s", cfg.PKCS11TokenLabel, cfg.PKCS11ModulePath)
+
+	return &pkcs11Backend{
+		log: log,
+		ctx: ctx,
+	}, nil
+}
+
+func (b *pkcs11Backend) Close() error {
+	return b.ctx.Close()
+}
+
+func (b *pkcs11Backend) Signer(keyRef string, _ *x509.Certificate) (crypto.Signer, error) {
+	key, err := b.ctx.FindKeyPair(nil, []byte(keyRef))
+	if err != nil {
+		return nil, fmt.Errorf("cannot find key pair: %w", err)
+	}
+
+	if key == nil {
+		return nil, fmt.Errorf("key pair labeled %q is not found on the token", keyRef)
+	}
+
+	b.log.Infof("Private key %q found on PKCS#11 token", keyRef)
+
+	return key, nil
+}
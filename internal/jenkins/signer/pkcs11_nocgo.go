@@ -0,0 +1,15 @@
+//go:build !cgo
+
+package signer
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+)
+
+func newPKCS11Backend(_ *zap.SugaredLogger, _ config.SignerConfig, _ string) (keyBackend, error) {
+	return nil, fmt.Errorf("PKCS#11 backend requires a build with cgo enabled")
+}
@@ -0,0 +1,83 @@
+//go:build cgo
+
+package signer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThalesIgnite/crypto11"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/types"
+)
+
+// TestPKCS11Backend runs against SoftHSM, e.g. after
+// `softhsm2-util --init-token --free --label resigner --pin 1234 --so-pin 1234`:
+// SOFTHSM2_MODULE=/usr/lib/softhsm/libsofthsm2.so PKCS11_TEST_TOKEN_LABEL=resigner PKCS11_TEST_PIN=1234
+func TestPKCS11Backend(t *testing.T) {
+	module, tokenLabel, pin := os.Getenv("SOFTHSM2_MODULE"), os.Getenv("PKCS11_TEST_TOKEN_LABEL"), os.Getenv("PKCS11_TEST_PIN")
+	if module == "" || tokenLabel == "" {
+		t.Skip("SOFTHSM2_MODULE and PKCS11_TEST_TOKEN_LABEL are not set")
+	}
+
+	ctx, err := crypto11.Configure(&crypto11.Config{Path: module, TokenLabel: tokenLabel, Pin: pin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Close()
+
+	keyLabel := "resigner-test-" + time.Now().Format("20060102150405")
+
+	key, err := ctx.GenerateRSAKeyPairWithLabel([]byte(keyLabel), []byte(keyLabel), 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Delete() //nolint:errcheck
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "PKCS#11"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPath := filepath.Join(t.TempDir(), "pkcs11.crt")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSignerService(log, config.SignerConfig{
+		Backend:          config.SignerBackendPKCS11,
+		PKCS11ModulePath: module,
+		PKCS11TokenLabel: tokenLabel,
+		KeyPassword:      pin,
+		CertificatePath:  certPath,
+		KeyPath:          keyLabel,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := types.SignedUpdateJSON{
+		InsecureUpdateJSON: unsigned,
+	}
+
+	if err := signed.Sign(context.Background(), s); err != nil {
+		t.Fatalf("signing error: %v", err)
+	}
+}
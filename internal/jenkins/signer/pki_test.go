@@ -0,0 +1,96 @@
+package signer
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+}
+
+func (c testCert) writePEM(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+
+	certPath, keyPath := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(c.key)}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certPath, keyPath
+}
+
+func (c testCert) material() *material {
+	return &material{cert: c.cert, chain: []*x509.Certificate{c.cert}, root: c.cert, key: c.key}
+}
+
+// newTestCert issues a certificate signed by the parent one or a self-signed one when parent is nil
+func newTestCert(t *testing.T, cn string, isCA bool, keyUsage x509.KeyUsage, notAfter time.Time, parent *testCert) testCert {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              keyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+
+	issuer, issuerKey := template, key
+	if parent != nil {
+		issuer, issuerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testCert{cert: cert, key: key}
+}
+
+type testPKI struct {
+	root, intermediate, leaf testCert
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	t.Helper()
+
+	validity := time.Now().Add(24 * time.Hour)
+
+	root := newTestCert(t, "Test Root CA", true, x509.KeyUsageCertSign, validity, nil)
+	intermediate := newTestCert(t, "Test Intermediate CA", true, x509.KeyUsageCertSign, validity, &root)
+	leaf := newTestCert(t, "Test Update Center", false, x509.KeyUsageDigitalSignature, validity, &intermediate)
+
+	return testPKI{
+		root:         root,
+		intermediate: intermediate,
+		leaf:         leaf,
+	}
+}
@@ -0,0 +1,103 @@
+package signer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Reload replaces the signing material with the one read from the configured files,
+// the old material is kept in use when the new one cannot be loaded or is not valid
+func (s *Service) Reload() error {
+	ms, err := s.loadMaterials()
+	if err != nil {
+		return fmt.Errorf("cannot reload signing material: %w", err)
+	}
+
+	s.mu.Lock()
+	s.materials = ms
+	s.mu.Unlock()
+
+	s.log.Infof("signing material reloaded, signing with certificate %q", s.active().cert.Subject)
+
+	return nil
+}
+
+// filesState returns the modification times and sizes of the signing material files to detect the changes
+func (s *Service) filesState() string {
+	var state strings.Builder
+
+	for _, path := range []string{
+		s.cfg.CAPath, s.cfg.CertificatePath, s.cfg.KeyPath, s.cfg.KeystorePath, s.cfg.KeyPasswordFile,
+		s.cfg.NextCertificatePath, s.cfg.NextKeyPath, s.cfg.NextKeystorePath,
+	} {
+		if path == "" {
+			continue
+		}
+
+		fi, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(&state, "%s:%v;", path, err)
+			continue
+		}
+
+		fmt.Fprintf(&state, "%s:%d:%d;", path, fi.ModTime().UnixNano(), fi.Size())
+	}
+
+	return state.String()
+}
+
+// RunReloader reloads the signing material on every reload request and whenever the files change,
+// it also reports the scheduled switch to the next certificate
+func (s *Service) RunReloader(ctx context.Context, reload <-chan os.Signal) {
+	s.log.Infow("starting signing material reloader")
+	defer s.log.Infow("signing material reloader stopped")
+
+	var (
+		state  = s.filesState()
+		active = s.active()
+		tick   <-chan time.Time
+	)
+
+	if s.cfg.ReloadCheckInterval > 0 {
+		ticker := time.NewTicker(s.cfg.ReloadCheckInterval)
+		defer ticker.Stop()
+
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-reload:
+			s.log.Infof("%s received, reloading signing material", sig)
+
+			if err := s.Reload(); err != nil {
+				s.log.Errorf("keeping the current signing material: %v", err)
+			}
+
+			state = s.filesState()
+		case <-tick:
+			if current := s.filesState(); current != state {
+				s.log.Infow("signing material files changed, reloading")
+
+				if err := s.Reload(); err != nil {
+					s.log.Errorf("keeping the current signing material: %v", err)
+				}
+
+				state = current
+			}
+		}
+
+		if m := s.active(); m != active {
+			if !m.cert.Equal(active.cert) {
+				s.log.Infof("switched to signing certificate %q valid until %s", m.cert.Subject, m.cert.NotAfter)
+			}
+
+			active = m
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package signer
+
+import (
+	"encoding/base64"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+)
+
+func TestReload(t *testing.T) {
+	validity := time.Now().Add(24 * time.Hour)
+	current := newTestCert(t, "Current", false, 0, validity, nil)
+	replacement := newTestCert(t, "Replacement", false, 0, validity, nil)
+
+	dir := t.TempDir()
+	certPath, keyPath := current.writePEM(t, dir, "signer")
+
+	s, err := NewSignerService(log, config.SignerConfig{CertificatePath: certPath, KeyPath: keyPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signedWith := func() string {
+		return s.SigningCertificates()[0]
+	}
+
+	// the certificate is replaced but the key is not yet
+	replacementCertPath, _ := replacement.writePEM(t, t.TempDir(), "signer")
+	if err := os.Rename(replacementCertPath, certPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Reload(); err == nil {
+		t.Fatal("mismatching certificate and key are accepted")
+	}
+
+	if signedWith() != base64.StdEncoding.EncodeToString(current.cert.Raw) {
+		t.Fatal("invalid signing material replaced the current one")
+	}
+
+	replacement.writePEM(t, dir, "signer")
+
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if signedWith() != base64.StdEncoding.EncodeToString(replacement.cert.Raw) {
+		t.Fatal("signing material is not reloaded")
+	}
+}
+
+func TestScheduledRollover(t *testing.T) {
+	validity := time.Now().Add(24 * time.Hour)
+	current := newTestCert(t, "Current", false, 0, validity, nil)
+	next := newTestCert(t, "Next", false, 0, validity, nil)
+
+	dir := t.TempDir()
+	certPath, keyPath := current.writePEM(t, dir, "current")
+	nextCertPath, nextKeyPath := next.writePEM(t, dir, "next")
+
+	for name, test := range map[string]struct {
+		activation time.Time
+		expected   testCert
+	}{
+		"pending":   {activation: time.Now().Add(time.Hour), expected: current},
+		"activated": {activation: time.Now().Add(-time.Minute), expected: next},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, err := NewSignerService(log, config.SignerConfig{
+				CertificatePath:     certPath,
+				KeyPath:             keyPath,
+				NextCertificatePath: nextCertPath,
+				NextKeyPath:         nextKeyPath,
+				NextActivationTime:  test.activation.Format(time.RFC3339),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if s.SigningCertificates()[0] != base64.StdEncoding.EncodeToString(test.expected.cert.Raw) {
+				t.Fatalf("not signing with certificate %q", test.expected.cert.Subject)
+			}
+		})
+	}
+}
+
+func TestRolloverAfterCurrentExpired(t *testing.T) {
+	expired := newTestCert(t, "Expired", false, 0, time.Now().Add(-time.Minute), nil)
+	next := newTestCert(t, "Next", false, 0, time.Now().Add(24*time.Hour), nil)
+
+	dir := t.TempDir()
+	certPath, keyPath := expired.writePEM(t, dir, "current")
+	nextCertPath, nextKeyPath := next.writePEM(t, dir, "next")
+
+	cfg := config.SignerConfig{
+		CertificatePath:     certPath,
+		KeyPath:             keyPath,
+		NextCertificatePath: nextCertPath,
+		NextKeyPath:         nextKeyPath,
+		NextActivationTime:  time.Now().Add(time.Hour).Format(time.RFC3339),
+	}
+
+	if _, err := NewSignerService(log, cfg); err == nil {
+		t.Fatal("expired current certificate accepted before the activation time")
+	}
+
+	cfg.NextActivationTime = time.Now().Add(-time.Hour).Format(time.RFC3339)
+
+	s, err := NewSignerService(log, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.SigningCertificates()[0] != base64.StdEncoding.EncodeToString(next.cert.Raw) {
+		t.Fatal("next certificate is not promoted")
+	}
+
+	if roots := s.RootCertificates(); len(roots) != 1 || !roots[0].Equal(next.cert) {
+		t.Fatal("expired root is still published")
+	}
+}
@@ -1,136 +1,241 @@
 package signer
 
 import (
+	"context"
 	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
-	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
+	"sync"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 
 	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
 	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/types"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/signinglog"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/tracing"
 )
 
 var (
 	_ types.Signer = (*Service)(nil)
 )
 
-type Service struct {
-	log   *zap.SugaredLogger
-	roots x509.CertPool
+// material is an immutable set of the signing certificate, the chain embedded into signatures and the private key
+type material struct {
 	cert  *x509.Certificate
-	priv  *rsa.PrivateKey
+	chain []*x509.Certificate
+	// root is the trust anchor of the chain Jenkins controllers need in update-center-rootCAs
+	root *x509.Certificate
+	key  crypto.Signer
+}
+
+// materials holds the current signing material and the optional next one which replaces it at the activation time
+type materials struct {
+	current        *material
+	next           *material
+	nextActivation time.Time
+}
+
+type Service struct {
+	log *zap.SugaredLogger
+	cfg config.SignerConfig
+	// backend provides the private keys not loaded from files, it is nil for the file backend
+	backend keyBackend
+	// signingLog records every signature made, it is nil when not configured
+	signingLog *signinglog.Log
+
+	mu        sync.RWMutex
+	materials materials
 }
 
 func NewSignerService(log *zap.SugaredLogger, cfg config.SignerConfig) (*Service, error) {
 	s := &Service{
 		log: log,
+		cfg: cfg,
+	}
+
+	var err error
+
+	if s.backend, err = s.newKeyBackend(); err != nil {
+		return nil, fmt.Errorf("cannot initialize %s signer backend: %w", cfg.Backend, err)
+	}
+
+	ms, err := s.loadMaterials()
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("signer parameters are not valid: %w", err), s.Close())
 	}
 
-	if err := s.parseSignerParameters(cfg); err != nil {
-		return nil, fmt.Errorf("signer parameters are not valid: %w", err)
+	s.materials = ms
+
+	if cfg.LogPath != "" {
+		if s.signingLog, err = signinglog.Open(log, cfg.LogPath); err != nil {
+			return nil, errors.Join(err, s.Close())
+		}
+
+		log.Infof("signatures are recorded in %s", cfg.LogPath)
 	}
 
 	return s, nil
 }
 
-func (s *Service) GetSignature(unsigned json.Marshaler) (types.Signature, error) {
+// active returns the signing material to be used at the moment
+func (s *Service) active() *material {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.materials.next != nil && !time.Now().Before(s.materials.nextActivation) {
+		return s.materials.next
+	}
+
+	return s.materials.current
+}
+
+// SigningCertificates returns the certificates embedded into signatures made at the moment
+func (s *Service) SigningCertificates() []string {
+	return JSONSignatureComponents{}.GetCertificates(s.active().chain)
+}
+
+// RootCertificates returns the root CAs of the current and the scheduled signing certificates, the chains not
+// ending with a self-signed one have none
+func (s *Service) RootCertificates() []*x509.Certificate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var roots []*x509.Certificate
+
+	for _, m := range []*material{s.materials.current, s.materials.next} {
+		if m == nil || m.root == nil || (len(roots) > 0 && roots[0].Equal(m.root)) {
+			continue
+		}
+
+		roots = append(roots, m.root)
+	}
+
+	return roots
+}
+
+// Close closes the signing log and releases the signer backend
+func (s *Service) Close() error {
+	var errs []error
+
+	if s.signingLog != nil {
+		errs = append(errs, s.signingLog.Close())
+	}
+
+	if s.backend != nil {
+		errs = append(errs, s.backend.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *Service) GetSignature(ctx context.Context, unsigned json.Marshaler) (_ types.Signature, err error) {
+	ctx, span := tracing.Start(ctx, "GetSignature")
+	defer func() { tracing.End(span, err) }()
+
 	var (
 		signature = JSONSignatureComponents{}
-		err       error
+		m         = s.active()
 	)
 
+	if s.cfg.RefuseExpired && !isCertificateValidAt(m.cert, time.Now()) {
+		return types.Signature{}, fmt.Errorf("refusing to sign with certificate %q valid between %s and %s", m.cert.Subject, m.cert.NotBefore, m.cert.NotAfter)
+	}
+
+	_, marshalSpan := tracing.Start(ctx, "MarshalJSON")
 	bytez, err := unsigned.MarshalJSON()
+	tracing.End(marshalSpan, err)
+
 	if err != nil {
 		return types.Signature{}, fmt.Errorf("cannot marshal unsigned JSON: %w", err)
 	}
 
 	signature.digest1, signature.digest512 = getDigestSHA1(bytez), getDigestSHA512(bytez)
 
-	signature.signature512, err = rsa.SignPKCS1v15(rand.Reader, s.priv, crypto.SHA512, signature.digest512)
-	if err != nil {
-		return types.Signature{}, fmt.Errorf("cannot sign JSON document with SHA512WithRSA: %w", err)
-	}
+	_, signSpan := tracing.Start(ctx, "RSASign", attribute.String("signer.backend", s.cfg.Backend))
+	err = signDigests(m, &signature)
+	tracing.End(signSpan, err)
 
-	signature.signature1, err = rsa.SignPKCS1v15(rand.Reader, s.priv, crypto.SHA1, signature.digest1)
 	if err != nil {
-		return types.Signature{}, fmt.Errorf("cannot sign JSON document with SHA1WithRSA: %w", err)
+		return types.Signature{}, err
 	}
 
-	return signature.GetSignatureObject(s.roots, s.cert), nil
-}
-
-func (s *Service) isDigestsMatch(computedDigest []byte, providedDigest string) bool {
-	// SHA-512
-	if strings.EqualFold(providedDigest, hex.EncodeToString(computedDigest)) {
-		return true
+	// a signature the certificate does not verify is never published, so it is not recorded either
+	if err := verifyDigests(m, signature); err != nil {
+		return types.Signature{}, err
 	}
 
-	// Base64
-	if strings.EqualFold(providedDigest, base64.StdEncoding.EncodeToString(computedDigest)) {
-		return true
+	if err := s.record(ctx, m, signature); err != nil {
+		return types.Signature{}, err
 	}
 
-	return false
+	return signature.GetSignatureObject(m.chain), nil
 }
 
-func (s *Service) VerifySignature(unsigned json.Marshaler, signature types.Signature) error {
-	bytez, err := unsigned.MarshalJSON()
+func signDigests(m *material, signature *JSONSignatureComponents) error {
+	var err error
+
+	signature.signature512, err = m.key.Sign(rand.Reader, signature.digest512, crypto.SHA512)
 	if err != nil {
-		return fmt.Errorf("cannot marshal unsigned JSON: %w", err)
+		return fmt.Errorf("cannot sign JSON document with SHA512WithRSA: %w", err)
 	}
 
-	certificates, err := signature.GetCertificates()
+	signature.signature1, err = m.key.Sign(rand.Reader, signature.digest1, crypto.SHA1)
 	if err != nil {
-		return fmt.Errorf("cannot extract certificates from json-file: %w", err)
+		return fmt.Errorf("cannot sign JSON document with SHA1WithRSA: %w", err)
 	}
 
-	if len(certificates) < 1 {
-		return fmt.Errorf("cannot verify signature: certificates are not present")
-	}
-	crt, ok := certificates[0].PublicKey.(*rsa.PublicKey)
-	if !ok {
-		return fmt.Errorf("cannot cast PublicKey")
-	}
+	return nil
+}
 
-	// SHA512...
-	shaXDigest := getDigestSHA512(bytez)
-	if !s.isDigestsMatch(shaXDigest, signature.CorrectDigest512) {
-		return fmt.Errorf("provided and computed SHA512 digests are different: %s vs %s", hex.EncodeToString(shaXDigest), signature.CorrectDigest512)
+// verifyDigests checks the signatures made by the backend against the signing certificate
+func verifyDigests(m *material, signature JSONSignatureComponents) error {
+	pub, ok := m.cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("certificate %q has no RSA public key", m.cert.Subject)
 	}
 
-	sig, err := hex.DecodeString(signature.CorrectSignature512)
-	if err != nil {
-		return fmt.Errorf("cannot decode sha512 signature: %w", err)
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA512, signature.digest512, signature.signature512); err != nil {
+		return fmt.Errorf("SHA512WithRSA signature is not verified by certificate %q: %w", m.cert.Subject, err)
 	}
 
-	err = rsa.VerifyPKCS1v15(crt, crypto.SHA512, shaXDigest, sig)
-	if err != nil {
-		return fmt.Errorf("sha256 signature verification failed: %w", err)
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA1, signature.digest1, signature.signature1); err != nil {
+		return fmt.Errorf("SHA1WithRSA signature is not verified by certificate %q: %w", m.cert.Subject, err)
 	}
 
-	// SHA1...
-	shaXDigest = getDigestSHA1(bytez)
+	return nil
+}
 
-	if !s.isDigestsMatch(shaXDigest, signature.CorrectDigest) {
-		return fmt.Errorf("provided and computed SHA1 digests are different: %s vs %s", hex.EncodeToString(shaXDigest), signature.CorrectDigest)
+// record appends the signature to the signing log, a signature which is not recorded must not be published
+func (s *Service) record(ctx context.Context, m *material, signature JSONSignatureComponents) error {
+	if s.signingLog == nil {
+		return nil
 	}
 
-	sig, err = base64.StdEncoding.DecodeString(signature.CorrectSignature)
-	if err != nil {
-		return fmt.Errorf("cannot base64 decode sha1 signature: %w", err)
-	}
+	details := types.SigningDetailsFromContext(ctx)
 
-	err = rsa.VerifyPKCS1v15(crt, crypto.SHA1, shaXDigest, sig)
-	if err != nil {
-		return fmt.Errorf("sha1 signature verification failed: %w", err)
+	if _, err := s.signingLog.Append(signinglog.Entry{
+		Source:                 details.Source,
+		Caller:                 details.Caller,
+		DocumentSHA512:         hex.EncodeToString(signature.digest512),
+		DocumentSHA1:           hex.EncodeToString(signature.digest1),
+		GenerationTimestamp:    details.GenerationTimestamp,
+		Patchers:               details.Patchers,
+		CertificateFingerprint: certificateFingerprint(m.cert),
+		Signature512:           hex.EncodeToString(signature.signature512),
+	}); err != nil {
+		return fmt.Errorf("cannot record signature in signing log: %w", err)
 	}
 
 	return nil
 }
+
+func (s *Service) VerifySignature(unsigned json.Marshaler, signature types.Signature) error {
+	return verifySignature(unsigned, signature)
+}
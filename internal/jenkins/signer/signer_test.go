@@ -1,6 +1,7 @@
 package signer
 
 import (
+	"context"
 	"reflect"
 	"testing"
 
@@ -123,7 +124,7 @@ func TestSign(t *testing.T) {
 		InsecureUpdateJSON: unsigned,
 	}
 
-	if err := signed.Sign(s); err != nil {
+	if err := signed.Sign(context.Background(), s); err != nil {
 		t.Fatalf("signing error: %v", err)
 	}
 
@@ -0,0 +1,91 @@
+package signer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/types"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/signinglog"
+)
+
+func TestSigningLog(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "signing.log")
+
+	s, err := NewSignerService(log, config.SignerConfig{
+		CertificatePath: "../../../testdata/certs/test.crt",
+		KeyPath:         "../../../testdata/certs/test.key",
+		LogPath:         logPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	details := types.SigningDetails{
+		Source:              "refresh",
+		GenerationTimestamp: "2024-08-18T10:00:00Z",
+		Patchers:            []string{"download-url"},
+	}
+
+	signature, err := s.GetSignature(types.WithSigningDetails(context.Background(), details), unsigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	entries, err := signinglog.Lookup(f, signature.CorrectDigest512)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Fatalf("%d entries found for the signed document", len(entries))
+	}
+
+	e := entries[0]
+	if e.Source != details.Source || e.GenerationTimestamp != details.GenerationTimestamp || !reflect.DeepEqual(e.Patchers, details.Patchers) ||
+		e.Signature512 != signature.CorrectSignature512 || e.CertificateFingerprint != s.CertificateInfo().FingerprintSHA256 {
+		t.Fatalf("unexpected signing log entry: %+v", e)
+	}
+}
+
+func TestUnverifiedSignatureNotRecorded(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "signing.log")
+
+	s, err := NewSignerService(log, config.SignerConfig{
+		CertificatePath: "../../../testdata/certs/test.crt",
+		KeyPath:         "../../../testdata/certs/test.key",
+		LogPath:         logPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// a backend signing with another key than the certificate's one
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.materials.current.key = other
+
+	if _, err := s.GetSignature(context.Background(), unsigned); err == nil {
+		t.Fatal("signature not verified by the certificate returned")
+	}
+
+	if data, err := os.ReadFile(logPath); err != nil || len(data) != 0 {
+		t.Fatalf("unverified signature recorded: %q, %v", data, err)
+	}
+}
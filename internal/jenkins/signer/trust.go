@@ -0,0 +1,185 @@
+package signer
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/types"
+)
+
+var (
+	_ types.SignatureVerifier = (*UpstreamVerifier)(nil)
+)
+
+// parseCertificates parses all the PEM certificates from data or a single DER one
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+
+	for {
+		var block *pem.Block
+
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		cert, err := x509.ParseCertificate(data)
+		if err != nil {
+			return nil, fmt.Errorf("neither PEM nor DER certificate found")
+		}
+
+		certs = append(certs, cert)
+	}
+
+	return certs, nil
+}
+
+// LoadTrustStore loads the certificates from a PEM bundle or a directory laid out like
+// ${JENKINS_HOME}/update-center-rootCAs, where every file except *.txt holds certificates
+func LoadTrustStore(trustStorePath string) ([]*x509.Certificate, error) {
+	fi, err := os.Stat(trustStorePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open trust store: %w", err)
+	}
+
+	files := []string{trustStorePath}
+
+	if fi.IsDir() {
+		entries, err := os.ReadDir(trustStorePath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read trust store directory: %w", err)
+		}
+
+		files = files[:0]
+
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasSuffix(entry.Name(), ".txt") {
+				continue
+			}
+
+			files = append(files, filepath.Join(trustStorePath, entry.Name()))
+		}
+	}
+
+	var certs []*x509.Certificate
+
+	for _, file := range files {
+		data, err := os.ReadFile(file) //nolint:gosec
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s: %w", file, err)
+		}
+
+		fileCerts, err := parseCertificates(data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load certificates from %s: %w", file, err)
+		}
+
+		certs = append(certs, fileCerts...)
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found in %s", trustStorePath)
+	}
+
+	return certs, nil
+}
+
+// VerifyCertificateChain validates the signature certificates the way Jenkins JSONSignatureValidator does:
+// every certificate must be valid at the moment, the first one must be allowed to sign data and
+// the chain must lead to one of the trusted roots
+func VerifyCertificateChain(certs []*x509.Certificate, roots *x509.CertPool, now time.Time) error {
+	if len(certs) == 0 {
+		return fmt.Errorf("certificates are not present")
+	}
+
+	for _, cert := range certs {
+		if now.Before(cert.NotBefore) {
+			return fmt.Errorf("certificate %q is not valid before %s", cert.Subject, cert.NotBefore)
+		}
+
+		if now.After(cert.NotAfter) {
+			return fmt.Errorf("certificate %q expired at %s", cert.Subject, cert.NotAfter)
+		}
+	}
+
+	leaf := certs[0]
+
+	if leaf.KeyUsage != 0 && leaf.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return fmt.Errorf("certificate %q is not allowed to be used for digital signatures", leaf.Subject)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf("certificate %q chain validation failed: %w", leaf.Subject, err)
+	}
+
+	return nil
+}
+
+// UpstreamVerifier checks the upstream file signature with the certificate chain validated against the trust store
+type UpstreamVerifier struct {
+	log   *zap.SugaredLogger
+	roots *x509.CertPool
+}
+
+func NewUpstreamVerifier(log *zap.SugaredLogger, trustStorePath string) (*UpstreamVerifier, error) {
+	certs, err := LoadTrustStore(trustStorePath)
+	if err != nil {
+		return nil, err
+	}
+
+	roots := x509.NewCertPool()
+	for _, cert := range certs {
+		roots.AddCert(cert)
+
+		log.Infof("upstream trust anchor %q loaded, valid until %s", cert.Subject, cert.NotAfter)
+	}
+
+	return &UpstreamVerifier{
+		log:   log,
+		roots: roots,
+	}, nil
+}
+
+func (v *UpstreamVerifier) VerifySignature(unsigned json.Marshaler, signature types.Signature) error {
+	certificates, err := signature.GetCertificates()
+	if err != nil {
+		return fmt.Errorf("cannot extract certificates from json-file: %w", err)
+	}
+
+	if err := VerifyCertificateChain(certificates, v.roots, time.Now()); err != nil {
+		return fmt.Errorf("untrusted signature certificates: %w", err)
+	}
+
+	return verifySignature(unsigned, signature)
+}
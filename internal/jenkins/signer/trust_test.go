@@ -0,0 +1,198 @@
+package signer
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/types"
+)
+
+func TestLoadTrustStore(t *testing.T) {
+	pki := newTestPKI(t)
+
+	dir := t.TempDir()
+	pki.root.writePEM(t, dir, "root")
+
+	if err := os.WriteFile(filepath.Join(dir, "README.txt"), []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "root.key")); err != nil {
+		t.Fatal(err)
+	}
+
+	certs, err := LoadTrustStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(certs) != 1 || !certs[0].Equal(pki.root.cert) {
+		t.Fatalf("unexpected certificates loaded: %d", len(certs))
+	}
+}
+
+func TestUpstreamVerifier(t *testing.T) {
+	pki := newTestPKI(t)
+
+	rootPath := filepath.Join(t.TempDir(), "root.pem")
+	if err := os.WriteFile(rootPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: pki.root.cert.Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := NewUpstreamVerifier(log, rootPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(t *testing.T, chain ...testCert) types.Signature {
+		t.Helper()
+
+		s := &Service{log: log, materials: materials{current: chain[0].material()}}
+
+		signature, err := s.GetSignature(context.Background(), unsigned)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		signature.Certificates = nil
+		for _, c := range chain {
+			signature.Certificates = append(signature.Certificates, base64.StdEncoding.EncodeToString(c.cert.Raw))
+		}
+
+		return signature
+	}
+
+	if err := v.VerifySignature(unsigned, sign(t, pki.leaf, pki.intermediate)); err != nil {
+		t.Fatalf("valid chain is rejected: %v", err)
+	}
+
+	other := newTestPKI(t)
+	expired := newTestCert(t, "Expired", false, x509.KeyUsageDigitalSignature, time.Now().Add(-time.Minute), &pki.intermediate)
+	caOnly := newTestCert(t, "CA only", false, x509.KeyUsageCertSign, time.Now().Add(time.Hour), &pki.intermediate)
+
+	cases := map[string]types.Signature{
+		"self-signed":          sign(t, other.root),
+		"untrusted-root":       sign(t, other.leaf, other.intermediate),
+		"missing-intermediate": sign(t, pki.leaf),
+		"expired":              sign(t, expired, pki.intermediate),
+		"no-digital-signature": sign(t, caOnly, pki.intermediate),
+	}
+
+	for name, signature := range cases {
+		t.Run(name, func(t *testing.T) {
+			if err := v.VerifySignature(unsigned, signature); err == nil {
+				t.Fatal("untrusted signature passed verification")
+			} else {
+				t.Logf("untrusted signature detected: %v", err)
+			}
+		})
+	}
+}
+
+func TestSignWithIntermediates(t *testing.T) {
+	pki := newTestPKI(t)
+
+	dir := t.TempDir()
+	certPath, keyPath := pki.leaf.writePEM(t, dir, "leaf")
+
+	caPath := filepath.Join(dir, "ca-bundle.pem")
+	bundle := append(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: pki.intermediate.cert.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: pki.root.cert.Raw})...,
+	)
+	if err := os.WriteFile(caPath, bundle, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSignerService(log, config.SignerConfig{
+		CAPath:          caPath,
+		CertificatePath: certPath,
+		KeyPath:         keyPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := types.SignedUpdateJSON{
+		InsecureUpdateJSON: unsigned,
+	}
+
+	if err := signed.Sign(context.Background(), s); err != nil {
+		t.Fatalf("signing error: %v", err)
+	}
+
+	expected := []string{
+		base64.StdEncoding.EncodeToString(pki.leaf.cert.Raw),
+		base64.StdEncoding.EncodeToString(pki.intermediate.cert.Raw),
+	}
+
+	if !reflect.DeepEqual(signed.Signature.Certificates, expected) {
+		t.Fatalf("signature certificates are not leaf and intermediate ones: %d certificates", len(signed.Signature.Certificates))
+	}
+
+	if rootCerts := s.RootCertificates(); len(rootCerts) != 1 || !rootCerts[0].Equal(pki.root.cert) {
+		t.Fatalf("unexpected root certificates: %d certificates", len(rootCerts))
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(pki.root.cert)
+
+	if err := (&UpstreamVerifier{log: log, roots: roots}).VerifySignature(unsigned, signed.Signature); err != nil {
+		t.Fatalf("signature is not trusted by the root: %v", err)
+	}
+
+	otherPKI := newTestPKI(t)
+	otherCAPath := filepath.Join(dir, "other-ca.pem")
+	if err := os.WriteFile(otherCAPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: otherPKI.root.cert.Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewSignerService(log, config.SignerConfig{
+		CAPath:          otherCAPath,
+		CertificatePath: certPath,
+		KeyPath:         keyPath,
+	}); err == nil {
+		t.Fatal("certificate not issued by the configured CA is accepted")
+	}
+}
+
+func TestSignWithIntermediatesOnly(t *testing.T) {
+	pki := newTestPKI(t)
+
+	dir := t.TempDir()
+	certPath, keyPath := pki.leaf.writePEM(t, dir, "leaf")
+	caPath, _ := pki.intermediate.writePEM(t, dir, "intermediate")
+
+	s, err := NewSignerService(log, config.SignerConfig{
+		CAPath:          caPath,
+		CertificatePath: certPath,
+		KeyPath:         keyPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := types.SignedUpdateJSON{
+		InsecureUpdateJSON: unsigned,
+	}
+
+	if err := signed.Sign(context.Background(), s); err != nil {
+		t.Fatalf("signing error: %v", err)
+	}
+
+	if len(signed.Signature.Certificates) != 2 {
+		t.Fatalf("intermediate is not embedded: %d certificates", len(signed.Signature.Certificates))
+	}
+
+	if rootCerts := s.RootCertificates(); len(rootCerts) != 0 {
+		t.Fatalf("intermediate %q published as the root CA", rootCerts[0].Subject)
+	}
+}
@@ -0,0 +1,83 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/types"
+)
+
+func isDigestsMatch(computedDigest []byte, providedDigest string) bool {
+	// SHA-512
+	if strings.EqualFold(providedDigest, hex.EncodeToString(computedDigest)) {
+		return true
+	}
+
+	// Base64
+	if strings.EqualFold(providedDigest, base64.StdEncoding.EncodeToString(computedDigest)) {
+		return true
+	}
+
+	return false
+}
+
+// verifySignature checks the digests and signatures against the first certificate embedded in the signature
+func verifySignature(unsigned json.Marshaler, signature types.Signature) error {
+	bytez, err := unsigned.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("cannot marshal unsigned JSON: %w", err)
+	}
+
+	certificates, err := signature.GetCertificates()
+	if err != nil {
+		return fmt.Errorf("cannot extract certificates from json-file: %w", err)
+	}
+
+	if len(certificates) < 1 {
+		return fmt.Errorf("cannot verify signature: certificates are not present")
+	}
+	crt, ok := certificates[0].PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("cannot cast PublicKey")
+	}
+
+	// SHA512...
+	shaXDigest := getDigestSHA512(bytez)
+	if !isDigestsMatch(shaXDigest, signature.CorrectDigest512) {
+		return fmt.Errorf("provided and computed SHA512 digests are different: %s vs %s", hex.EncodeToString(shaXDigest), signature.CorrectDigest512)
+	}
+
+	sig, err := hex.DecodeString(signature.CorrectSignature512)
+	if err != nil {
+		return fmt.Errorf("cannot decode sha512 signature: %w", err)
+	}
+
+	err = rsa.VerifyPKCS1v15(crt, crypto.SHA512, shaXDigest, sig)
+	if err != nil {
+		return fmt.Errorf("sha256 signature verification failed: %w", err)
+	}
+
+	// SHA1...
+	shaXDigest = getDigestSHA1(bytez)
+
+	if !isDigestsMatch(shaXDigest, signature.CorrectDigest) {
+		return fmt.Errorf("provided and computed SHA1 digests are different: %s vs %s", hex.EncodeToString(shaXDigest), signature.CorrectDigest)
+	}
+
+	sig, err = base64.StdEncoding.DecodeString(signature.CorrectSignature)
+	if err != nil {
+		return fmt.Errorf("cannot base64 decode sha1 signature: %w", err)
+	}
+
+	err = rsa.VerifyPKCS1v15(crt, crypto.SHA1, shaXDigest, sig)
+	if err != nil {
+		return fmt.Errorf("sha1 signature verification failed: %w", err)
+	}
+
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/sourcefileproviders"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/metrics"
 )
 
 var (
@@ -66,10 +67,14 @@ func (c *Cache) refreshContent(ctx context.Context) error {
 	}
 
 	if metadata == c.metadata && err == nil {
+		metrics.CacheRequests.WithLabelValues("hit").Inc()
+
 		c.log.Debugf("cached JSONP body is up-to-date, skipping update")
 		return nil
 	}
 
+	metrics.CacheRequests.WithLabelValues("miss").Inc()
+
 	metadata, signedJSON, err := c.p.GetBody(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get JSONP body: %w", err)
@@ -95,6 +100,11 @@ func (c *Cache) refreshContent(ctx context.Context) error {
 	return nil
 }
 
+// Refresh revalidates the cached copy without waiting for the cache TTL
+func (c *Cache) Refresh(ctx context.Context) error {
+	return c.refreshContent(ctx)
+}
+
 func (c *Cache) runCacheWorker(ctx context.Context, cacheDuration time.Duration) {
 	c.log.Infow("starting cache refresh worker")
 	defer c.log.Infow("cache refresh worker stopped")
@@ -5,7 +5,7 @@ import (
 )
 
 type FileMetadata struct {
-	LastModified time.Time
-	Size         int64
-	Etag         string
+	LastModified time.Time `json:"lastModified"`
+	Size         int64     `json:"size"`
+	Etag         string    `json:"etag,omitempty"`
 }
@@ -9,9 +9,12 @@ import (
 	"os"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.uber.org/zap"
 
 	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/sourcefileproviders"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/metrics"
 )
 
 var (
@@ -37,6 +40,8 @@ func NewRemoteURLProvider(log *zap.SugaredLogger, sURL string) (*Provider, error
 	}
 
 	p.hc = &http.Client{
+		// propagates the trace context of the refresh to the upstream
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
 		// TODO: something goes wrong with this settings
 		// Transport: &http.Transport{
 		//   MaxIdleConns:    MaxIdleConns,
@@ -87,6 +92,8 @@ func (p *Provider) getRemoteURLMetadata(r *http.Response) (sourcefileproviders.F
 func (p *Provider) GetMetadata(ctx context.Context) (sourcefileproviders.FileMetadata, error) {
 	p.log.Debugf("HEAD %s...", p.url)
 
+	defer prometheus.NewTimer(metrics.UpstreamDuration.WithLabelValues(http.MethodHead)).ObserveDuration()
+
 	req, err := http.NewRequest(http.MethodHead, p.url, http.NoBody)
 	if err != nil {
 		return sourcefileproviders.FileMetadata{}, fmt.Errorf("cannot create request: %w", err)
@@ -109,6 +116,8 @@ func (p *Provider) GetMetadata(ctx context.Context) (sourcefileproviders.FileMet
 func (p *Provider) GetBody(ctx context.Context) (sourcefileproviders.FileMetadata, io.ReadCloser, error) {
 	p.log.Debugf("GET %s...", p.url)
 
+	defer prometheus.NewTimer(metrics.UpstreamDuration.WithLabelValues(http.MethodGet)).ObserveDuration()
+
 	req, err := http.NewRequest(http.MethodGet, p.url, http.NoBody)
 	if err != nil {
 		return sourcefileproviders.FileMetadata{}, nil, fmt.Errorf("cannot create request: %w", err)
@@ -136,6 +145,8 @@ func (p *Provider) GetBody(ctx context.Context) (sourcefileproviders.FileMetadat
 	p.log.Debugf("%s temporary file created", f.Name())
 
 	length, err := io.Copy(f, resp.Body)
+	metrics.UpstreamBytes.Add(float64(length))
+
 	if err != nil {
 		return sourcefileproviders.FileMetadata{}, nil, fmt.Errorf("cannot write body to temporary file: %w", err)
 	}
@@ -0,0 +1,131 @@
+package jenkins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/sourcefileproviders"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/types"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/metrics"
+)
+
+var ErrNoGeneration = errors.New("no generation is published yet")
+
+// RevalidatingProvider is implemented by the source file providers keeping a copy of the original file
+type RevalidatingProvider interface {
+	Refresh(ctx context.Context) error
+}
+
+// Generation describes a published signed document
+type Generation struct {
+	// GenerationTimestamp is the upstream generationTimestamp
+	GenerationTimestamp string                           `json:"generationTimestamp"`
+	FetchedAt           time.Time                        `json:"fetchedAt"`
+	PublishedAt         time.Time                        `json:"publishedAt"`
+	Source              sourcefileproviders.FileMetadata `json:"source"`
+	Digest512           string                           `json:"digest512"`
+
+	// original is the verified upstream document the feed variants are patched from
+	original []byte
+}
+
+type RefreshError struct {
+	Time    time.Time `json:"time"`
+	Stage   string    `json:"stage"`
+	Message string    `json:"message"`
+}
+
+type PatcherStatus struct {
+	Name  string `json:"name"`
+	Stats any    `json:"stats,omitempty"`
+}
+
+type Status struct {
+	Current   *Generation   `json:"current"`
+	Previous  *Generation   `json:"previous"`
+	LastError *RefreshError `json:"lastError"`
+	// ConsecutiveFailures counts the refreshes failed since the last generation was published
+	ConsecutiveFailures int             `json:"consecutiveFailures"`
+	Patchers            []PatcherStatus `json:"patchers"`
+	Variants            []VariantStatus `json:"variants,omitempty"`
+}
+
+// Status reports the served and the previously served generations, the last refresh error and the patchers
+func (s *Service) Status() Status {
+	s.patchedMu.RLock()
+	status := Status{
+		Current:             s.current,
+		Previous:            s.previous,
+		LastError:           s.lastError,
+		ConsecutiveFailures: s.consecutiveFailures,
+		Patchers:            make([]PatcherStatus, 0, len(s.patchers)),
+	}
+	s.patchedMu.RUnlock()
+
+	for _, patcher := range s.patchers {
+		ps := PatcherStatus{Name: patcher.Name()}
+
+		if reporter, ok := patcher.(types.PatcherStats); ok {
+			ps.Stats = reporter.Stats()
+		}
+
+		status.Patchers = append(status.Patchers, ps)
+	}
+
+	status.Variants = s.variantsStatus()
+
+	return status
+}
+
+// ForceRefresh regenerates the served document even when the original file did not change,
+// a kept copy of the original file is revalidated first
+func (s *Service) ForceRefresh(ctx context.Context) error {
+	if p, ok := s.sourceFileProvider.(RevalidatingProvider); ok {
+		if err := p.Refresh(ctx); err != nil {
+			metrics.RefreshAttempts.Inc()
+
+			return s.failed(metrics.StageFetch, fmt.Errorf("cannot revalidate original file: %w", err))
+		}
+	}
+
+	return s.regenerate(ctx)
+}
+
+// RunRefresher refreshes the served files in the background, so they do not get stale when no feed requests come
+func (s *Service) RunRefresher(ctx context.Context) {
+	if s.cfg.RefreshInterval <= 0 {
+		return
+	}
+
+	s.log.Infow("starting background refresher")
+	defer s.log.Infow("background refresher stopped")
+
+	ticker := time.NewTicker(s.cfg.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.refresh(ctx); err != nil {
+				s.log.Errorf("background refresh failed: %v", err)
+			}
+		}
+	}
+}
+
+// GetOriginalBody returns the verified original document the served generation is made from, not patched
+func (s *Service) GetOriginalBody() (sourcefileproviders.FileMetadata, []byte, error) {
+	s.patchedMu.RLock()
+	current := s.current
+	s.patchedMu.RUnlock()
+
+	if current == nil {
+		return sourcefileproviders.FileMetadata{}, nil, ErrNoGeneration
+	}
+
+	return current.Source, current.original, nil
+}
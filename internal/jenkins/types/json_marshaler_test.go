@@ -42,7 +42,7 @@ func TestMarshalJSON(t *testing.T) {
 	juc := jenkins.NewJenkinsUpdateCenter(log, config.AppConfig{
 		DataDirPath:              "/tmp",
 		GetUpdateJSONBodyTimeout: 3 * time.Second,
-	}, p, nil, nil)
+	}, p, nil, nil, nil)
 
 	_, signedJSON, err := juc.GetOriginal(ctx)
 	if err != nil {
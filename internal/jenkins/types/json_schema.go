@@ -1,7 +1,10 @@
 package types
 
 import (
+	"context"
 	"fmt"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/tracing"
 )
 
 type InsecureUpdateJSON struct {
@@ -13,6 +16,9 @@ type InsecureUpdateJSON struct {
 	Plugins             Plugins                `json:"plugins"`
 	UpdateCenterVersion string                 `json:"updateCenterVersion"`
 	Warnings            []interface{}          `json:"warnings"`
+
+	// MirrorFallbacks lists the artifacts served from a fallback mirror or upstream instead of the primary mirror
+	MirrorFallbacks map[string]string `json:"mirrorFallbacks,omitempty"`
 }
 
 type SignedUpdateJSON struct {
@@ -20,13 +26,17 @@ type SignedUpdateJSON struct {
 	Signature Signature `json:"signature"`
 }
 
-func (o *SignedUpdateJSON) Sign(signer Signer) error {
-	signature, err := signer.GetSignature(o.GetUnsigned())
+func (o *SignedUpdateJSON) Sign(ctx context.Context, signer Signer) error {
+	signature, err := signer.GetSignature(ctx, o.GetUnsigned())
 	if err != nil {
 		return fmt.Errorf("cannot calculate signature: %w", err)
 	}
 
-	if err := signer.VerifySignature(o.InsecureUpdateJSON, signature); err != nil {
+	_, span := tracing.Start(ctx, "VerifySignature")
+	err = signer.VerifySignature(o.InsecureUpdateJSON, signature)
+	tracing.End(span, err)
+
+	if err != nil {
 		return fmt.Errorf("cannot verify signature: %w", err)
 	}
 
@@ -1,5 +1,22 @@
 package types
 
+import (
+	"context"
+)
+
 type Patcher interface {
-	Patch(insecureJSON *InsecureUpdateJSON) error
+	// Name identifies the patcher in the signing log
+	Name() string
+	Patch(ctx context.Context, insecureJSON *InsecureUpdateJSON) error
+}
+
+// PatcherStats is implemented by the patchers reporting the outcome of their last run
+type PatcherStats interface {
+	Stats() any
+}
+
+// DownloadURLPatcher is implemented by the patchers depending on the mirror the downloads are pointed to
+type DownloadURLPatcher interface {
+	// WithDownloadURL returns the same patcher pointing the downloads to the URL, the stats are kept apart
+	WithDownloadURL(downloadURL string) Patcher
 }
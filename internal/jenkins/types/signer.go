@@ -1,10 +1,37 @@
 package types
 
 import (
+	"context"
 	"encoding/json"
 )
 
-type Signer interface {
-	GetSignature(unsinged json.Marshaler) (Signature, error)
+type SignatureVerifier interface {
 	VerifySignature(unsinged json.Marshaler, signature Signature) error
 }
+
+type Signer interface {
+	SignatureVerifier
+
+	GetSignature(ctx context.Context, unsinged json.Marshaler) (Signature, error)
+}
+
+// SigningDetails describes what is being signed for the signing log
+type SigningDetails struct {
+	// Source is the component requesting the signature
+	Source string
+	// Caller is the authenticated client the document is signed for
+	Caller              string
+	GenerationTimestamp string
+	Patchers            []string
+}
+
+type signingDetailsKey struct{}
+
+func WithSigningDetails(ctx context.Context, details SigningDetails) context.Context {
+	return context.WithValue(ctx, signingDetailsKey{}, details)
+}
+
+func SigningDetailsFromContext(ctx context.Context) SigningDetails {
+	details, _ := ctx.Value(signingDetailsKey{}).(SigningDetails)
+	return details
+}
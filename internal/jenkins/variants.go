@@ -0,0 +1,200 @@
+package jenkins
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/types"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/metrics"
+)
+
+// ErrTooManyVariants is returned when --mirror-profile-max-variants variants of the generation are signed already
+var ErrTooManyVariants = errors.New("too many feed variants")
+
+// Variant is the current generation patched for another download URL and signed
+type Variant struct {
+	DownloadURL string
+	SignedAt    time.Time
+	// Files are the served files by name
+	Files map[string][]byte
+}
+
+// variantCall is the variant being signed, the concurrent requests for the same URL wait for it
+type variantCall struct {
+	done chan struct{}
+	v    *Variant
+	err  error
+}
+
+type VariantStatus struct {
+	DownloadURL string    `json:"downloadUrl"`
+	SignedAt    time.Time `json:"signedAt"`
+}
+
+// keepOriginal returns the verified original document with its upstream signature, the feed variants are patched
+// from it and the admin API serves it
+func (s *Service) keepOriginal(signedJSON *types.SignedUpdateJSON) ([]byte, error) {
+	original, err := signedJSON.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("cannot keep original file: %w", err)
+	}
+
+	return original, nil
+}
+
+// GetVariant returns the current generation with the downloads pointed to the URL, the variants are signed on
+// the first request and kept until the next generation is published. A variant is signed once however many
+// requests ask for it meanwhile, the other URLs are served and signed in parallel.
+func (s *Service) GetVariant(ctx context.Context, downloadURL string) (*Variant, error) {
+	s.variantsMu.Lock()
+
+	s.patchedMu.RLock()
+	current := s.current
+	s.patchedMu.RUnlock()
+
+	if current == nil || current.original == nil {
+		s.variantsMu.Unlock()
+
+		return nil, fmt.Errorf("cannot make feed variant: %w", ErrNoGeneration)
+	}
+
+	if s.variantsOf != current {
+		s.variants, s.variantsSigning, s.variantsOf = map[string]*Variant{}, map[string]*variantCall{}, current
+	}
+
+	if v, ok := s.variants[downloadURL]; ok {
+		s.variantsMu.Unlock()
+
+		return v, nil
+	}
+
+	call, signing := s.variantsSigning[downloadURL]
+	if !signing {
+		if len(s.variants)+len(s.variantsSigning) >= s.cfg.Server.MirrorProfiles.MaxVariants {
+			s.variantsMu.Unlock()
+
+			return nil, ErrTooManyVariants
+		}
+
+		call = &variantCall{done: make(chan struct{})}
+		s.variantsSigning[downloadURL] = call
+	}
+
+	s.variantsMu.Unlock()
+
+	if signing {
+		select {
+		case <-call.done:
+			return call.v, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// the waiting requests must not fail because the one signing was cancelled
+	call.v, call.err = s.makeVariant(context.WithoutCancel(ctx), current, downloadURL)
+	if call.err != nil {
+		call.err = fmt.Errorf("cannot make feed variant for %s: %w", downloadURL, call.err)
+	}
+
+	s.variantsMu.Lock()
+
+	// the variants of a generation replaced meanwhile are dropped with it
+	if s.variantsOf == current {
+		delete(s.variantsSigning, downloadURL)
+
+		if call.err == nil {
+			s.variants[downloadURL] = call.v
+		}
+	}
+
+	s.variantsMu.Unlock()
+
+	close(call.done)
+
+	return call.v, call.err
+}
+
+func (s *Service) makeVariant(ctx context.Context, generation *Generation, downloadURL string) (*Variant, error) {
+	signedJSON := &types.SignedUpdateJSON{InsecureUpdateJSON: &types.InsecureUpdateJSON{}}
+
+	if err := json.Unmarshal(generation.original, signedJSON.InsecureUpdateJSON); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal original file: %w", err)
+	}
+
+	if err := patch(ctx, s.variantPatchers(downloadURL), signedJSON); err != nil {
+		return nil, err
+	}
+
+	if err := signedJSON.Sign(s.signingContext(ctx, signedJSON, "variant"), s.signer); err != nil {
+		return nil, fmt.Errorf("cannot sign: %w", err)
+	}
+
+	metrics.FeedVariantsSigned.Inc()
+
+	bytez, err := signedJSON.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal: %w", err)
+	}
+
+	v := &Variant{DownloadURL: downloadURL, SignedAt: time.Now(), Files: make(map[string][]byte, len(servedFiles))}
+
+	for _, file := range servedFiles {
+		var buf bytes.Buffer
+
+		if err := s.writeDataWithTrailers(&buf, bytes.NewReader(bytez), file.prefix, file.suffix); err != nil {
+			return nil, err
+		}
+
+		v.Files[file.name] = buf.Bytes()
+	}
+
+	s.log.Infof("feed variant for %s signed", downloadURL)
+
+	return v, nil
+}
+
+// variantPatchers returns the configured patchers with the downloads pointed to the URL
+func (s *Service) variantPatchers(downloadURL string) []types.Patcher {
+	patchers := make([]types.Patcher, 0, len(s.patchers))
+
+	for _, p := range s.patchers {
+		if retargeted, ok := p.(types.DownloadURLPatcher); ok {
+			p = retargeted.WithDownloadURL(downloadURL)
+		}
+
+		patchers = append(patchers, p)
+	}
+
+	return patchers
+}
+
+// variantsStatus lists the variants of the current generation
+func (s *Service) variantsStatus() []VariantStatus {
+	s.variantsMu.Lock()
+	defer s.variantsMu.Unlock()
+
+	s.patchedMu.RLock()
+	current := s.current
+	s.patchedMu.RUnlock()
+
+	if s.variantsOf != current {
+		return nil
+	}
+
+	status := make([]VariantStatus, 0, len(s.variants))
+	for _, v := range s.variants {
+		status = append(status, VariantStatus{DownloadURL: v.DownloadURL, SignedAt: v.SignedAt})
+	}
+
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].DownloadURL < status[j].DownloadURL
+	})
+
+	return status
+}
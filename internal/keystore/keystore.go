@@ -0,0 +1,408 @@
+// Package keystore decodes password protected key containers: Java JKS and JCEKS keystores and encrypted PKCS#8 keys
+package keystore
+
+import (
+	"bytes"
+	"crypto/sha1" //nolint:gosec
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	magicJKS   uint32 = 0xfeedfeed
+	magicJCEKS uint32 = 0xcececece
+
+	version2 = 2
+
+	tagPrivateKey  = 1
+	tagTrustedCert = 2
+	tagSecretKey   = 3
+
+	certTypeX509 = "X.509"
+)
+
+// integritySalt is mixed into the keystore digest by the Java implementation
+var integritySalt = []byte("Mighty Aphrodite")
+
+// IsKeyStore reports whether the data starts with the JKS or JCEKS magic number
+func IsKeyStore(data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+
+	magic := binary.BigEndian.Uint32(data)
+
+	return magic == magicJKS || magic == magicJCEKS
+}
+
+type PrivateKeyEntry struct {
+	CreatedAt time.Time
+	// encryptedKey is the protected PKCS#8 private key, it is decrypted on demand as it may use its own password
+	encryptedKey []byte
+	Chain        []*x509.Certificate
+}
+
+type TrustedCertificateEntry struct {
+	CreatedAt   time.Time
+	Certificate *x509.Certificate
+}
+
+type KeyStore struct {
+	jceks               bool
+	PrivateKeys         map[string]PrivateKeyEntry
+	TrustedCertificates map[string]TrustedCertificateEntry
+}
+
+func New() *KeyStore {
+	return &KeyStore{
+		PrivateKeys:         map[string]PrivateKeyEntry{},
+		TrustedCertificates: map[string]TrustedCertificateEntry{},
+	}
+}
+
+// Aliases returns the sorted private key aliases
+func (ks *KeyStore) Aliases() []string {
+	aliases := make([]string, 0, len(ks.PrivateKeys))
+	for alias := range ks.PrivateKeys {
+		aliases = append(aliases, alias)
+	}
+
+	sort.Strings(aliases)
+
+	return aliases
+}
+
+// PrivateKey decrypts the private key stored under the alias, the only key is returned when alias is empty
+func (ks *KeyStore) PrivateKey(alias, password string) (any, []*x509.Certificate, error) {
+	if alias == "" {
+		aliases := ks.Aliases()
+		if len(aliases) != 1 {
+			return nil, nil, fmt.Errorf("alias must be set to choose one of %d private keys: %v", len(aliases), aliases)
+		}
+
+		alias = aliases[0]
+	}
+
+	entry, ok := ks.PrivateKeys[alias]
+	if !ok {
+		return nil, nil, fmt.Errorf("private key %q not found, available aliases: %v", alias, ks.Aliases())
+	}
+
+	var (
+		der []byte
+		err error
+	)
+
+	if ks.jceks {
+		der, err = decryptJCEKSKey(entry.encryptedKey, password)
+	} else {
+		der, err = decryptJKSKey(entry.encryptedKey, password)
+	}
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot decrypt private key %q: %w", alias, err)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot parse private key %q: %w", alias, err)
+	}
+
+	return key, entry.Chain, nil
+}
+
+// SetPrivateKey stores the private key protected with the password under the alias
+func (ks *KeyStore) SetPrivateKey(alias string, key any, chain []*x509.Certificate, password string) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("cannot marshal private key: %w", err)
+	}
+
+	encrypted, err := encryptJKSKey(der, password)
+	if err != nil {
+		return err
+	}
+
+	ks.jceks = false
+	ks.PrivateKeys[alias] = PrivateKeyEntry{
+		CreatedAt:    time.Now(),
+		encryptedKey: encrypted,
+		Chain:        chain,
+	}
+
+	return nil
+}
+
+func (ks *KeyStore) SetTrustedCertificate(alias string, cert *x509.Certificate) {
+	ks.TrustedCertificates[alias] = TrustedCertificateEntry{
+		CreatedAt:   time.Now(),
+		Certificate: cert,
+	}
+}
+
+// passwordBytes encodes the password the way Java does for the keystore integrity check and the JKS key protector
+func passwordBytes(password string) []byte {
+	var buf bytes.Buffer
+	for _, c := range utf16.Encode([]rune(password)) {
+		_ = binary.Write(&buf, binary.BigEndian, c)
+	}
+
+	return buf.Bytes()
+}
+
+func integrityDigest(password string, data []byte) []byte {
+	h := sha1.New() //nolint:gosec
+	h.Write(passwordBytes(password))
+	h.Write(integritySalt)
+	h.Write(data)
+
+	return h.Sum(nil)
+}
+
+type reader struct {
+	r *bytes.Reader
+}
+
+func (r reader) uint16() (uint16, error) {
+	var v uint16
+	err := binary.Read(r.r, binary.BigEndian, &v)
+
+	return v, err
+}
+
+func (r reader) uint32() (uint32, error) {
+	var v uint32
+	err := binary.Read(r.r, binary.BigEndian, &v)
+
+	return v, err
+}
+
+func (r reader) time() (time.Time, error) {
+	var v int64
+	if err := binary.Read(r.r, binary.BigEndian, &v); err != nil {
+		return time.Time{}, err
+	}
+
+	return time.UnixMilli(v), nil
+}
+
+func (r reader) bytes(n int) ([]byte, error) {
+	if n > r.r.Len() {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	b := make([]byte, n)
+	_, err := io.ReadFull(r.r, b)
+
+	return b, err
+}
+
+func (r reader) string() (string, error) {
+	n, err := r.uint16()
+	if err != nil {
+		return "", err
+	}
+
+	b, err := r.bytes(int(n))
+
+	return string(b), err
+}
+
+func (r reader) certificate() (*x509.Certificate, error) {
+	certType, err := r.string()
+	if err != nil {
+		return nil, err
+	}
+
+	if certType != certTypeX509 {
+		return nil, fmt.Errorf("unsupported certificate type %q", certType)
+	}
+
+	n, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := r.bytes(int(n))
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(der)
+}
+
+// Decode parses a JKS or JCEKS keystore checking its integrity with the password
+func Decode(data []byte, password string) (*KeyStore, error) {
+	if len(data) < sha1.Size+12 {
+		return nil, fmt.Errorf("keystore is truncated")
+	}
+
+	body, digest := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	if !bytes.Equal(integrityDigest(password, body), digest) {
+		return nil, fmt.Errorf("keystore password is incorrect or keystore is corrupted")
+	}
+
+	ks := New()
+	r := reader{r: bytes.NewReader(body)}
+
+	magic, _ := r.uint32()
+	switch magic {
+	case magicJKS:
+	case magicJCEKS:
+		ks.jceks = true
+	default:
+		return nil, fmt.Errorf("not a JKS or JCEKS keystore")
+	}
+
+	if ver, _ := r.uint32(); ver != version2 {
+		return nil, fmt.Errorf("unsupported keystore version %d", ver)
+	}
+
+	count, _ := r.uint32()
+
+	for i := uint32(0); i < count; i++ {
+		if err := ks.decodeEntry(r); err != nil {
+			return nil, fmt.Errorf("cannot decode keystore entry %d: %w", i, err)
+		}
+	}
+
+	return ks, nil
+}
+
+func (ks *KeyStore) decodeEntry(r reader) error {
+	tag, err := r.uint32()
+	if err != nil {
+		return err
+	}
+
+	alias, err := r.string()
+	if err != nil {
+		return err
+	}
+
+	createdAt, err := r.time()
+	if err != nil {
+		return err
+	}
+
+	switch tag {
+	case tagPrivateKey:
+		n, err := r.uint32()
+		if err != nil {
+			return err
+		}
+
+		encrypted, err := r.bytes(int(n))
+		if err != nil {
+			return err
+		}
+
+		chainLen, err := r.uint32()
+		if err != nil {
+			return err
+		}
+
+		var chain []*x509.Certificate
+
+		for j := uint32(0); j < chainLen; j++ {
+			cert, err := r.certificate()
+			if err != nil {
+				return fmt.Errorf("cannot decode %q certificate chain: %w", alias, err)
+			}
+
+			chain = append(chain, cert)
+		}
+
+		ks.PrivateKeys[alias] = PrivateKeyEntry{CreatedAt: createdAt, encryptedKey: encrypted, Chain: chain}
+	case tagTrustedCert:
+		cert, err := r.certificate()
+		if err != nil {
+			return fmt.Errorf("cannot decode %q certificate: %w", alias, err)
+		}
+
+		ks.TrustedCertificates[alias] = TrustedCertificateEntry{CreatedAt: createdAt, Certificate: cert}
+	case tagSecretKey:
+		return errors.New("secret key entries are not supported")
+	default:
+		return fmt.Errorf("unknown entry type %d", tag)
+	}
+
+	return nil
+}
+
+type writer struct {
+	buf bytes.Buffer
+}
+
+func (w *writer) uint16(v uint16)  { _ = binary.Write(&w.buf, binary.BigEndian, v) }
+func (w *writer) uint32(v uint32)  { _ = binary.Write(&w.buf, binary.BigEndian, v) }
+func (w *writer) time(t time.Time) { _ = binary.Write(&w.buf, binary.BigEndian, t.UnixMilli()) }
+
+func (w *writer) string(s string) {
+	w.uint16(uint16(len(s))) //nolint:gosec
+	w.buf.WriteString(s)
+}
+
+func (w *writer) certificate(cert *x509.Certificate) {
+	w.string(certTypeX509)
+	w.uint32(uint32(len(cert.Raw))) //nolint:gosec
+	w.buf.Write(cert.Raw)
+}
+
+// Encode writes the keystore in the JKS format protecting its integrity with the password
+func (ks *KeyStore) Encode(out io.Writer, password string) error {
+	if ks.jceks && len(ks.PrivateKeys) > 0 {
+		return fmt.Errorf("JCEKS private keys cannot be re-encoded")
+	}
+
+	w := &writer{}
+
+	w.uint32(magicJKS)
+	w.uint32(version2)
+	w.uint32(uint32(len(ks.PrivateKeys) + len(ks.TrustedCertificates))) //nolint:gosec
+
+	for _, alias := range ks.Aliases() {
+		entry := ks.PrivateKeys[alias]
+
+		w.uint32(tagPrivateKey)
+		w.string(alias)
+		w.time(entry.CreatedAt)
+		w.uint32(uint32(len(entry.encryptedKey))) //nolint:gosec
+		w.buf.Write(entry.encryptedKey)
+		w.uint32(uint32(len(entry.Chain))) //nolint:gosec
+
+		for _, cert := range entry.Chain {
+			w.certificate(cert)
+		}
+	}
+
+	aliases := make([]string, 0, len(ks.TrustedCertificates))
+	for alias := range ks.TrustedCertificates {
+		aliases = append(aliases, alias)
+	}
+
+	sort.Strings(aliases)
+
+	for _, alias := range aliases {
+		entry := ks.TrustedCertificates[alias]
+
+		w.uint32(tagTrustedCert)
+		w.string(alias)
+		w.time(entry.CreatedAt)
+		w.certificate(entry.Certificate)
+	}
+
+	w.buf.Write(integrityDigest(password, w.buf.Bytes()))
+
+	if _, err := out.Write(w.buf.Bytes()); err != nil {
+		return fmt.Errorf("cannot write keystore: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/des" //nolint:gosec
+	"crypto/md5" //nolint:gosec
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec
+	"crypto/subtle"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+)
+
+var (
+	// oidJKSKeyProtector is the proprietary Sun algorithm protecting JKS private keys
+	oidJKSKeyProtector = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 17, 1, 1}
+	// oidPBEWithMD5AndTripleDES protects JCEKS private keys
+	oidPBEWithMD5AndTripleDES = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 19, 1}
+)
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     algorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbeParameters struct {
+	Salt       []byte
+	Iterations int
+}
+
+// jksKeystream derives the XOR keystream of the JKS key protector
+func jksKeystream(password, salt []byte, n int) []byte {
+	var (
+		keystream = make([]byte, 0, n+sha1.Size)
+		digest    = salt
+	)
+
+	for len(keystream) < n {
+		h := sha1.New() //nolint:gosec
+		h.Write(password)
+		h.Write(digest)
+		digest = h.Sum(nil)
+
+		keystream = append(keystream, digest...)
+	}
+
+	return keystream[:n]
+}
+
+func jksCheck(password, plain []byte) []byte {
+	h := sha1.New() //nolint:gosec
+	h.Write(password)
+	h.Write(plain)
+
+	return h.Sum(nil)
+}
+
+func decryptJKSKey(encoded []byte, password string) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(encoded, &info); err != nil {
+		return nil, fmt.Errorf("cannot parse encrypted key: %w", err)
+	}
+
+	if !info.Algorithm.Algorithm.Equal(oidJKSKeyProtector) {
+		return nil, fmt.Errorf("unsupported JKS key protection algorithm %s", info.Algorithm.Algorithm)
+	}
+
+	data := info.EncryptedData
+	if len(data) < 2*sha1.Size {
+		return nil, errors.New("encrypted key is truncated")
+	}
+
+	var (
+		pwd       = passwordBytes(password)
+		salt      = data[:sha1.Size]
+		encrypted = data[sha1.Size : len(data)-sha1.Size]
+		check     = data[len(data)-sha1.Size:]
+		plain     = make([]byte, len(encrypted))
+	)
+
+	subtle.XORBytes(plain, encrypted, jksKeystream(pwd, salt, len(encrypted)))
+
+	if !bytes.Equal(jksCheck(pwd, plain), check) {
+		return nil, errors.New("key password is incorrect")
+	}
+
+	return plain, nil
+}
+
+func encryptJKSKey(plain []byte, password string) ([]byte, error) {
+	var (
+		pwd  = passwordBytes(password)
+		salt = make([]byte, sha1.Size)
+	)
+
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("cannot generate salt: %w", err)
+	}
+
+	encrypted := make([]byte, len(plain))
+	subtle.XORBytes(encrypted, plain, jksKeystream(pwd, salt, len(plain)))
+
+	data := append(append(append([]byte{}, salt...), encrypted...), jksCheck(pwd, plain)...)
+
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm: algorithmIdentifier{
+			Algorithm:  oidJKSKeyProtector,
+			Parameters: asn1.NullRawValue,
+		},
+		EncryptedData: data,
+	})
+}
+
+// pbeWithMD5AndTripleDES derives the key and IV the way the SunJCE PBEWithMD5AndTripleDES cipher does
+func pbeWithMD5AndTripleDES(password string, salt []byte, iterations int) ([]byte, []byte, error) {
+	if len(salt) != 8 {
+		return nil, nil, fmt.Errorf("unexpected salt length %d", len(salt))
+	}
+
+	salt = append([]byte{}, salt...)
+	if bytes.Equal(salt[:4], salt[4:]) {
+		salt[0], salt[1], salt[2], salt[3] = salt[3], salt[2], salt[1], salt[0]
+	}
+
+	pwd := make([]byte, 0, len(password))
+	for _, c := range password {
+		pwd = append(pwd, byte(c&0x7f))
+	}
+
+	derived := make([]byte, 0, 2*md5.Size)
+
+	for i := 0; i < 2; i++ {
+		digest := salt[i*4 : (i+1)*4]
+
+		for j := 0; j < iterations; j++ {
+			h := md5.New() //nolint:gosec
+			h.Write(digest)
+			h.Write(pwd)
+			digest = h.Sum(nil)
+		}
+
+		derived = append(derived, digest...)
+	}
+
+	return derived[:24], derived[24:], nil
+}
+
+func decryptJCEKSKey(encoded []byte, password string) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(encoded, &info); err != nil {
+		return nil, fmt.Errorf("cannot parse encrypted key: %w", err)
+	}
+
+	if info.Algorithm.Algorithm.Equal(oidJKSKeyProtector) {
+		return decryptJKSKey(encoded, password)
+	}
+
+	if !info.Algorithm.Algorithm.Equal(oidPBEWithMD5AndTripleDES) {
+		return nil, fmt.Errorf("unsupported JCEKS key protection algorithm %s", info.Algorithm.Algorithm)
+	}
+
+	var params pbeParameters
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("cannot parse PBE parameters: %w", err)
+	}
+
+	key, iv, err := pbeWithMD5AndTripleDES(password, params.Salt, params.Iterations)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := des.NewTripleDESCipher(key) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+
+	return decryptCBC(block, iv, info.EncryptedData)
+}
+
+// decryptCBC decrypts the data and strips PKCS#5 padding
+func decryptCBC(block cipher.Block, iv, data []byte) ([]byte, error) {
+	if len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, errors.New("encrypted data is not aligned to the cipher block size")
+	}
+
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > block.BlockSize() || !bytes.Equal(plain[len(plain)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, errors.New("key password is incorrect")
+	}
+
+	return plain[:len(plain)-padding], nil
+}
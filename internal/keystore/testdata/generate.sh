@@ -0,0 +1,11 @@
+#!/bin/sh
+# Generates the keytool fixtures decoded by TestKeytoolFixtures, the key password differs from the store password
+set -e
+
+cd "$(dirname "$0")"
+
+for type in jks jceks; do
+	rm -f "signer.$type"
+	keytool -genkeypair -keyalg RSA -keysize 2048 -validity 36500 -dname "CN=keytool fixture" \
+		-alias signer -keystore "signer.$type" -storetype "$type" -storepass storepass -keypass keypass
+done
@@ -0,0 +1,127 @@
+// Package metrics holds the Prometheus metrics of the service, they are exposed on /metrics
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "resigner"
+
+// refresh stages failures are reported by
+const (
+	StageFetch  = "fetch"
+	StageVerify = "verify"
+	StagePatch  = "patch"
+	StageSign   = "sign"
+	StageWrite  = "write"
+)
+
+var (
+	RefreshAttempts = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "refresh_attempts_total",
+		Help:      "Regenerations of the served update center started because the original file or the signing material changed, and original file checks failed before one.",
+	})
+	RefreshSuccesses = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "refresh_successes_total",
+		Help:      "Regenerations of the served update center completed.",
+	})
+	RefreshFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "refresh_failures_total",
+		Help:      "Failed refreshes by the stage they failed at.",
+	}, []string{"stage"})
+
+	UpstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Upstream update center request latency, the body download included.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"method"})
+	UpstreamBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_received_bytes_total",
+		Help:      "Bytes of the original update center files downloaded.",
+	})
+
+	CacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Cache revalidations by result, a miss downloads the original file.",
+	}, []string{"result"})
+
+	FeedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "feed_requests_total",
+		Help:      "Served update center requests by HTTP status.",
+	}, []string{"status"})
+
+	FeedVariantsSigned = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "feed_variants_signed_total",
+		Help:      "Update center variants patched for the mirror profiles and signed.",
+	})
+
+	MirrorAuditArtifacts = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "mirror_audit_artifacts",
+		Help:      "Artifacts checked by the last mirror audit by result.",
+	}, []string{"result"})
+	MirrorAuditPluginProblems = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "mirror_audit_plugin_problems",
+		Help:      "Plugins whose artifact the last mirror audit found missing or mismatched, by plugin and problem.",
+	}, []string{"plugin", "problem"})
+	MirrorAuditTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "mirror_audit_timestamp_seconds",
+		Help:      "Completion time of the last mirror audit.",
+	})
+
+	ArtifactProxiedBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "artifact_proxied_bytes_total",
+		Help:      "Bytes of the artifacts proxied from the real mirror.",
+	})
+
+	generationTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "feed_generation_timestamp_seconds",
+		Help:      "Generation timestamp of the served update center.",
+	})
+	generation atomic.Int64
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "feed_age_seconds",
+		Help:      "Time since the served update center was generated.",
+	}, func() float64 {
+		if ts := generation.Load(); ts != 0 {
+			return time.Since(time.Unix(ts, 0)).Seconds()
+		}
+
+		return 0
+	})
+)
+
+// SetFeedGeneration records the generation timestamp of the served update center
+func SetFeedGeneration(t time.Time) {
+	generation.Store(t.Unix())
+	generationTimestamp.Set(float64(t.Unix()))
+}
+
+// RegisterSigningCertificate exposes the expiry of the certificate signing at the moment, it is called once
+func RegisterSigningCertificate(notAfter func() time.Time) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "signing_certificate_expiry_timestamp_seconds",
+		Help:      "Expiry of the signing certificate in use.",
+	}, func() float64 {
+		return float64(notAfter().Unix())
+	})
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/auth"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+)
+
+// tokenQueryParam carries the access token in update site URLs, it is not passed to the mirrors
+const tokenQueryParam = "token"
+
+const (
+	// verifiedCredentialsTTL is how long a verified htpasswd password is accepted without running bcrypt again
+	verifiedCredentialsTTL = time.Minute
+	maxVerifiedCredentials = 1024
+)
+
+type principalKey struct{}
+
+// principal names who made the request in the request log, it is the client certificate or the access control one
+type principal struct {
+	name string
+}
+
+func withPrincipal(r *http.Request) (*http.Request, *principal) {
+	p := &principal{}
+
+	return r.WithContext(context.WithValue(r.Context(), principalKey{}, p)), p
+}
+
+func setPrincipal(r *http.Request, name string) {
+	if p, ok := r.Context().Value(principalKey{}).(*principal); ok {
+		p.name = name
+	}
+}
+
+type accessControl struct {
+	tokens   auth.Tokens
+	users    auth.Htpasswd
+	verified *auth.CredentialCache
+	allowed  []*net.IPNet
+	// certs are the allowed client certificate names, any verified certificate is allowed when empty
+	certs map[string]bool
+}
+
+// parseNetworks accepts CIDRs and single addresses
+func parseNetworks(specs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(specs))
+
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+
+		if ip := net.ParseIP(spec); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(spec)
+		if err != nil {
+			return nil, fmt.Errorf("network %q is incorrect: %w", spec, err)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) *net.IPNet {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return network
+		}
+	}
+
+	return nil
+}
+
+// newAccessControl returns nil when the feed and the downloads are public
+func newAccessControl(cfg config.AccessConfig) (*accessControl, error) {
+	if cfg.TokensPath == "" && cfg.HtpasswdPath == "" && len(cfg.AllowCIDRs) == 0 && len(cfg.ClientCerts) == 0 {
+		return nil, nil
+	}
+
+	var (
+		a   = &accessControl{}
+		err error
+	)
+
+	if cfg.TokensPath != "" {
+		if a.tokens, err = auth.LoadTokens(cfg.TokensPath); err != nil {
+			return nil, fmt.Errorf("cannot load access tokens: %w", err)
+		}
+	}
+
+	if cfg.HtpasswdPath != "" {
+		if a.users, err = auth.LoadHtpasswd(cfg.HtpasswdPath); err != nil {
+			return nil, fmt.Errorf("cannot load htpasswd file: %w", err)
+		}
+
+		a.verified = auth.NewCredentialCache(verifiedCredentialsTTL, maxVerifiedCredentials)
+	}
+
+	if a.allowed, err = parseNetworks(cfg.AllowCIDRs); err != nil {
+		return nil, fmt.Errorf("invalid allowed networks: %w", err)
+	}
+
+	if len(cfg.ClientCerts) > 0 {
+		a.certs = make(map[string]bool, len(cfg.ClientCerts))
+
+		for _, name := range cfg.ClientCerts {
+			a.certs[strings.TrimSpace(name)] = true
+		}
+	}
+
+	return a, nil
+}
+
+// allowsCertificate checks the verified client certificate against the allowed names
+func (a *accessControl) allowsCertificate(r *http.Request) bool {
+	cert := verifiedClientCertificate(r)
+	if cert == nil {
+		return false
+	}
+
+	if a.certs == nil {
+		return true
+	}
+
+	for _, name := range clientCertificateNames(cert) {
+		if a.certs[name] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// authenticate returns the principal the request is allowed for or the claimed one when it is denied,
+// a client certificate verified against the client CAs is enough unless the allowed names are configured
+func (a *accessControl) authenticate(r *http.Request, ip net.IP) (string, bool) {
+	if a.allowsCertificate(r) {
+		name, _ := clientCertificateName(r)
+
+		return "cert " + name, true
+	}
+
+	if network := containsIP(a.allowed, ip); network != nil {
+		return "network " + network.String(), true
+	}
+
+	if team, ok := a.tokens.Authenticate(r); ok {
+		return team, true
+	}
+
+	if token := r.URL.Query().Get(tokenQueryParam); token != "" {
+		if team, ok := a.tokens.Lookup(token); ok {
+			return team, true
+		}
+
+		return "query token", false
+	}
+
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			return "bearer token", false
+		}
+
+		return "anonymous", false
+	}
+
+	if a.users != nil && a.verified.Verify(user, password, a.users.Verify) {
+		return user, true
+	}
+
+	// the tokens work as API keys in user:key@host update site URLs
+	if team, ok := a.tokens.Lookup(password); ok {
+		return team, true
+	}
+
+	return user, false
+}
+
+// accessMiddleware lets the allowed clients through, it is a pass-through when the access is not restricted
+func (s Server) accessMiddleware(next http.Handler) http.Handler {
+	if s.access == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+
+		name, ok := s.access.authenticate(r, ip)
+		setPrincipal(r, name)
+
+		if !ok {
+			s.log.Warnw("access denied", "principal", name, "clientIP", ip.String(), "method", r.Method, "path", r.URL.Path)
+
+			if s.access.tokens == nil && s.access.users == nil {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+
+			w.Header().Set("WWW-Authenticate", `Basic realm="update-center"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+
+			return
+		}
+
+		// the token must not leak to the mirrors the request is proxied or redirected to
+		if query := r.URL.Query(); query.Has(tokenQueryParam) {
+			query.Del(tokenQueryParam)
+			r.URL.RawQuery = query.Encode()
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
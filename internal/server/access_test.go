@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+)
+
+type staticMirror string
+
+func (m staticMirror) Pick(_ net.IP) (string, bool) {
+	return string(m), true
+}
+
+func TestAccessControl(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+
+	dir := t.TempDir()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokensPath, htpasswdPath := filepath.Join(dir, "tokens"), filepath.Join(dir, "htpasswd")
+
+	if err := os.WriteFile(tokensPath, []byte("team-a: key-a\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(htpasswdPath, []byte("ci:"+string(hash)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.AccessConfig{
+		TokensPath:     tokensPath,
+		HtpasswdPath:   htpasswdPath,
+		AllowCIDRs:     []string{"10.1.0.0/16"},
+		TrustedProxies: []string{"192.168.0.1", trustUnixPeers},
+	}
+
+	access, err := newAccessControl(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxies, err := newTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := Server{
+		log:          logger.Sugar(),
+		cfg:          config.ServerConfig{DownloadMode: config.DownloadModeRedirect, FeedTimeout: time.Second},
+		mirrorPicker: staticMirror("https://mirror.local"),
+		access:       access,
+		proxies:      proxies,
+	}
+
+	handlers, err := s.getHandlers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		remoteAddr string
+		setup      func(r *http.Request)
+		status     int
+	}{
+		{name: "anonymous", status: http.StatusUnauthorized},
+		{name: "bearer token", setup: func(r *http.Request) { r.Header.Set("Authorization", "Bearer key-a") }, status: http.StatusFound},
+		{name: "wrong bearer token", setup: func(r *http.Request) { r.Header.Set("Authorization", "Bearer key-b") }, status: http.StatusUnauthorized},
+		{name: "basic auth", setup: func(r *http.Request) { r.SetBasicAuth("ci", "s3cret") }, status: http.StatusFound},
+		{name: "wrong password", setup: func(r *http.Request) { r.SetBasicAuth("ci", "key-a-") }, status: http.StatusUnauthorized},
+		{name: "token as password", setup: func(r *http.Request) { r.SetBasicAuth("anyone", "key-a") }, status: http.StatusFound},
+		{name: "query token", path: "/plugins/a.hpi?token=key-a", status: http.StatusFound},
+		{name: "allowed network", remoteAddr: "10.1.2.3:4567", status: http.StatusFound},
+		{
+			name:       "spoofed forwarded address",
+			remoteAddr: "172.16.0.1:4567",
+			setup:      func(r *http.Request) { r.Header.Set("X-Forwarded-For", "10.1.2.3") },
+			status:     http.StatusUnauthorized,
+		},
+		{
+			name:       "trusted proxy",
+			remoteAddr: "192.168.0.1:4567",
+			setup:      func(r *http.Request) { r.Header.Set("X-Forwarded-For", "203.0.113.1, 10.1.2.3") },
+			status:     http.StatusFound,
+		},
+		{
+			name:       "unix socket proxy",
+			remoteAddr: "@",
+			setup: func(r *http.Request) {
+				*r = *r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, &net.UnixAddr{Name: "/run/resigner.sock", Net: "unix"}))
+				r.Header.Set("X-Forwarded-For", "10.1.2.3")
+			},
+			status: http.StatusFound,
+		},
+		{name: "bootstrap is public", path: bootstrapCasCPath, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.path
+			if path == "" {
+				path = "/plugins/a.hpi"
+			}
+
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+
+			if tt.setup != nil {
+				tt.setup(req)
+			}
+
+			rec := httptest.NewRecorder()
+			handlers.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("returned %d, expected %d", rec.Code, tt.status)
+			}
+
+			if location := rec.Header().Get("Location"); tt.status == http.StatusFound && location != "https://mirror.local/plugins/a.hpi" {
+				t.Fatalf("redirected to %s", location)
+			}
+		})
+	}
+}
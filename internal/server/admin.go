@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/signer"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/sourcefileproviders"
+)
+
+const (
+	statusPath        = "/status"
+	adminRefreshPath  = "/admin/refresh"
+	adminUpstreamPath = "/admin/upstream.json"
+)
+
+type UpdateCenterAdmin interface {
+	Status() jenkins.Status
+	ForceRefresh(ctx context.Context) error
+	GetOriginalBody() (sourcefileproviders.FileMetadata, []byte, error)
+}
+
+type CertificateInfoProvider interface {
+	CertificateInfo() signer.CertificateInfo
+}
+
+type statusReport struct {
+	jenkins.Status
+
+	Certificate *signer.CertificateInfo `json:"certificate,omitempty"`
+}
+
+func (s Server) writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(v); err != nil {
+		s.log.Warnf("cannot write response: %v", err)
+	}
+}
+
+func (s Server) statusHandler(w http.ResponseWriter, _ *http.Request) {
+	report := statusReport{Status: s.updateCenter.Status()}
+
+	if s.certificates != nil {
+		info := s.certificates.CertificateInfo()
+		report.Certificate = &info
+	}
+
+	s.writeJSON(w, report)
+}
+
+// adminAuthMiddleware lets the admin API callers through and logs who called what
+func (s Server) adminAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller, ok := s.adminTokens.Authenticate(r)
+		if !ok {
+			s.log.Warnw("admin request rejected", "path", r.URL.Path, "remoteAddr", r.RemoteAddr, "reason", "unauthenticated")
+
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+
+			return
+		}
+
+		setPrincipal(r, caller)
+
+		s.log.Infow("admin request", "caller", caller, "method", r.Method, "path", r.URL.Path, "remoteAddr", r.RemoteAddr)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// refreshHandler regenerates the served document and reports the resulting status
+func (s Server) refreshHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.updateCenter.ForceRefresh(r.Context()); err != nil {
+		s.log.Errorf("forced refresh failed: %v", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+
+		return
+	}
+
+	s.statusHandler(w, r)
+}
+
+// upstreamHandler serves the verified original document the served one is generated from, before it is patched
+func (s Server) upstreamHandler(w http.ResponseWriter, _ *http.Request) {
+	metadata, body, err := s.updateCenter.GetOriginalBody()
+	if errors.Is(err, jenkins.ErrNoGeneration) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+
+		return
+	}
+
+	if err != nil {
+		s.log.Errorf("cannot get original file: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if !metadata.LastModified.IsZero() {
+		w.Header().Set("Last-Modified", metadata.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	// the document is served canonicalized, not byte for byte as fetched
+	if metadata.Etag != "" {
+		w.Header().Set("ETag", weakETag(metadata.Etag))
+	}
+
+	if _, err := w.Write(body); err != nil {
+		s.log.Warnf("cannot write original file: %v", err)
+	}
+}
+
+func weakETag(etag string) string {
+	if strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+
+	return "W/" + etag
+}
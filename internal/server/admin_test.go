@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/auth"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/sourcefileproviders"
+)
+
+type fakeUpdateCenter struct {
+	status    jenkins.Status
+	refreshes int
+}
+
+func (f *fakeUpdateCenter) Status() jenkins.Status {
+	return f.status
+}
+
+func (f *fakeUpdateCenter) ForceRefresh(_ context.Context) error {
+	f.refreshes++
+	return nil
+}
+
+func (f *fakeUpdateCenter) GetOriginalBody() (sourcefileproviders.FileMetadata, []byte, error) {
+	if f.status.Current == nil {
+		return sourcefileproviders.FileMetadata{}, nil, jenkins.ErrNoGeneration
+	}
+
+	return sourcefileproviders.FileMetadata{Etag: `"upstream"`}, []byte(`{"id":"default"}`), nil
+}
+
+func TestAdmin(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+
+	tokensPath := filepath.Join(t.TempDir(), "tokens")
+	if err := os.WriteFile(tokensPath, []byte("ops: s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := auth.LoadTokens(tokensPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updateCenter := &fakeUpdateCenter{status: jenkins.Status{
+		Current:  &jenkins.Generation{GenerationTimestamp: "2024-08-18T00:00:00Z", Digest512: "abc"},
+		Patchers: []jenkins.PatcherStatus{{Name: "download-url"}},
+	}}
+
+	s := Server{
+		log:          logger.Sugar(),
+		cfg:          config.ServerConfig{DownloadMode: config.DownloadModeRedirect, FeedTimeout: time.Second},
+		updateCenter: updateCenter,
+		adminTokens:  tokens,
+	}
+
+	handlers := s.getAdminHandlers()
+
+	request := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		rec := httptest.NewRecorder()
+		handlers.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	rec := request(http.MethodGet, statusPath, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status returned %d", rec.Code)
+	}
+
+	var status statusReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+
+	if status.Current == nil || status.Current.Digest512 != "abc" || len(status.Patchers) != 1 {
+		t.Fatalf("unexpected status %s", rec.Body)
+	}
+
+	if rec := request(http.MethodPost, adminRefreshPath, "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh with wrong token returned %d", rec.Code)
+	}
+
+	if updateCenter.refreshes != 0 {
+		t.Fatal("unauthenticated refresh was performed")
+	}
+
+	if rec := request(http.MethodPost, adminRefreshPath, "s3cret"); rec.Code != http.StatusOK || updateCenter.refreshes != 1 {
+		t.Fatalf("refresh returned %d, %d refreshes performed", rec.Code, updateCenter.refreshes)
+	}
+
+	rec = request(http.MethodGet, adminUpstreamPath, "s3cret")
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"id":"default"}` || rec.Header().Get("ETag") != `W/"upstream"` {
+		t.Fatalf("upstream returned %d %q", rec.Code, rec.Body)
+	}
+
+	updateCenter.status.Current = nil
+
+	if rec := request(http.MethodGet, adminUpstreamPath, "s3cret"); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("upstream without a generation returned %d", rec.Code)
+	}
+}
+
+func TestAdminListenerSeparation(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+
+	tokensPath := filepath.Join(t.TempDir(), "tokens")
+	if err := os.WriteFile(tokensPath, []byte("prometheus: s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := auth.LoadTokens(tokensPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := Server{
+		log: logger.Sugar(),
+		cfg: config.ServerConfig{
+			DownloadMode: config.DownloadModeRedirect,
+			FeedTimeout:  time.Second,
+			Admin:        config.AdminServerConfig{RequireAuth: true},
+		},
+		updateCenter: &fakeUpdateCenter{},
+		adminTokens:  tokens,
+		signAPI: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+		}),
+	}
+
+	public, err := s.getHandlers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := chi.Walk(public, func(_, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		for _, prefix := range []string{"/debug/", "/metrics", statusPath, "/admin/", "/sign"} {
+			if strings.HasPrefix(route, prefix) {
+				return fmt.Errorf("%s is served on the public listener", route)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	admin := s.getAdminHandlers()
+
+	for path, expected := range map[string]int{"/healthz": http.StatusOK, "/metrics": http.StatusUnauthorized, statusPath: http.StatusUnauthorized} {
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if rec.Code != expected {
+			t.Fatalf("%s returned %d, expected %d", path, rec.Code, expected)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("authenticated metrics request returned %d", rec.Code)
+	}
+
+	// the signing API callers have their own tokens
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/sign", strings.NewReader("{}")))
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("signing API on the admin listener returned %d", rec.Code)
+	}
+}
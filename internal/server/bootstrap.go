@@ -0,0 +1,100 @@
+package server
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins"
+)
+
+const (
+	bootstrapRootCAPath       = "/bootstrap/update-center-rootCA.pem"
+	bootstrapUpdateCenterPath = "/bootstrap/hudson.model.UpdateCenter.xml"
+	bootstrapCasCPath         = "/bootstrap/jenkins.yaml"
+)
+
+type TrustAnchorProvider interface {
+	RootCertificates() []*x509.Certificate
+}
+
+type updateCenterXML struct {
+	XMLName xml.Name        `xml:"sites"`
+	Sites   []updateSiteXML `xml:"site"`
+}
+
+type updateSiteXML struct {
+	ID  string `xml:"id"`
+	URL string `xml:"url"`
+}
+
+// requestBaseURL returns the URL the request reached the service at, X-Forwarded-Proto is only trusted from
+// the trusted proxies
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	if proto := r.Header.Get("X-Forwarded-Proto"); requestClient(r).viaTrustedProxy && (proto == "http" || proto == "https") {
+		scheme = proto
+	}
+
+	return scheme + "://" + r.Host
+}
+
+// updateSiteURL returns the update-center.json URL controllers are configured with
+func (s Server) updateSiteURL(r *http.Request) string {
+	publicURL := strings.TrimSuffix(s.cfg.PublicURL, "/")
+
+	if publicURL == "" {
+		publicURL = requestBaseURL(r)
+	}
+
+	return publicURL + "/" + jenkins.UpdateCenterDotJSON
+}
+
+// rootCAHandler serves the trust anchors to put to ${JENKINS_HOME}/update-center-rootCAs, the scheduled one included
+func (s Server) rootCAHandler(w http.ResponseWriter, _ *http.Request) {
+	roots := s.trustAnchors.RootCertificates()
+	if len(roots) == 0 {
+		http.Error(w, "the signing certificate chain has no root CA", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-pem-file")
+
+	for _, cert := range roots {
+		if err := pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err != nil {
+			s.log.Warnf("cannot write root CA: %v", err)
+			return
+		}
+	}
+}
+
+func (s Server) updateCenterXMLHandler(w http.ResponseWriter, r *http.Request) {
+	bytez, err := xml.MarshalIndent(updateCenterXML{
+		Sites: []updateSiteXML{{ID: s.cfg.UpdateSiteID, URL: s.updateSiteURL(r)}},
+	}, "", "    ")
+	if err != nil {
+		s.log.Errorf("cannot marshal update center configuration: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+
+	_, _ = fmt.Fprintf(w, "<?xml version='1.1' encoding='UTF-8'?>\n%s\n", bytez)
+}
+
+// casCHandler serves the Jenkins Configuration as Code snippet, the quoted JSON strings are valid YAML scalars
+func (s Server) casCHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+
+	_, _ = fmt.Fprintf(w, "jenkins:\n  updateCenter:\n    sites:\n      - id: %s\n        url: %s\n",
+		strconv.Quote(s.cfg.UpdateSiteID), strconv.Quote(s.updateSiteURL(r)))
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+)
+
+type staticTrustAnchors []*x509.Certificate
+
+func (a staticTrustAnchors) RootCertificates() []*x509.Certificate {
+	return a
+}
+
+func TestBootstrap(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+
+	data, err := os.ReadFile("../../testdata/certs/test.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := pem.Decode(data)
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxies, err := newTrustedProxies([]string{"192.168.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(cfg config.ServerConfig, path, remoteAddr string, header http.Header) string {
+		cfg.DownloadMode = config.DownloadModeRedirect
+
+		s := Server{log: logger.Sugar(), cfg: cfg, trustAnchors: staticTrustAnchors{cert}, proxies: proxies}
+
+		handlers, err := s.getHandlers()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "http://resigner.internal:8282"+path, nil)
+		req.RemoteAddr = remoteAddr
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		rec := httptest.NewRecorder()
+		handlers.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status %d", path, rec.Code)
+		}
+
+		body, _ := io.ReadAll(rec.Body)
+
+		return string(body)
+	}
+
+	if body := get(config.ServerConfig{}, bootstrapRootCAPath, "172.16.0.1:1234", nil); body != string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})) {
+		t.Fatalf("unexpected root CA:\n%s", body)
+	}
+
+	public := config.ServerConfig{PublicURL: "https://updates.example.com/", UpdateSiteID: "default"}
+
+	expectedXML := `<?xml version='1.1' encoding='UTF-8'?>
+<sites>
+    <site>
+        <id>default</id>
+        <url>https://updates.example.com/update-center.json</url>
+    </site>
+</sites>
+`
+	if body := get(public, bootstrapUpdateCenterPath, "172.16.0.1:1234", nil); body != expectedXML {
+		t.Fatalf("unexpected update center configuration:\n%s", body)
+	}
+
+	if body := get(public, bootstrapCasCPath, "172.16.0.1:1234", nil); !strings.Contains(body, `url: "https://updates.example.com/update-center.json"`) {
+		t.Fatalf("unexpected configuration as code:\n%s", body)
+	}
+
+	forwarded := http.Header{"X-Forwarded-Proto": {"https"}}
+
+	derived := get(config.ServerConfig{UpdateSiteID: "corp"}, bootstrapCasCPath, "192.168.0.1:1234", forwarded)
+	if !strings.Contains(derived, `id: "corp"`) || !strings.Contains(derived, `url: "https://resigner.internal:8282/update-center.json"`) {
+		t.Fatalf("unexpected configuration as code derived from the request:\n%s", derived)
+	}
+
+	spoofed := get(config.ServerConfig{UpdateSiteID: "corp"}, bootstrapCasCPath, "172.16.0.1:1234", forwarded)
+	if !strings.Contains(spoofed, `url: "http://resigner.internal:8282/update-center.json"`) {
+		t.Fatalf("X-Forwarded-Proto of an untrusted client used:\n%s", spoofed)
+	}
+}
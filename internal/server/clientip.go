@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustUnixPeers is the --access-trusted-proxy entry trusting the peers of the unix socket listeners
+const trustUnixPeers = "unix"
+
+type clientKey struct{}
+
+// client is the request origin resolved by clientMiddleware
+type client struct {
+	ip net.IP
+	// viaTrustedProxy tells the forwarding headers come from a trusted proxy
+	viaTrustedProxy bool
+}
+
+// trustedProxies are the reverse proxies reporting the client address in X-Forwarded-For and the scheme in
+// X-Forwarded-Proto, the headers of any other client are ignored
+type trustedProxies struct {
+	networks []*net.IPNet
+	unix     bool
+}
+
+func newTrustedProxies(specs []string) (trustedProxies, error) {
+	var (
+		t        trustedProxies
+		networks []string
+	)
+
+	for _, spec := range specs {
+		if strings.TrimSpace(spec) == trustUnixPeers {
+			t.unix = true
+			continue
+		}
+
+		networks = append(networks, spec)
+	}
+
+	var err error
+	if t.networks, err = parseNetworks(networks); err != nil {
+		return trustedProxies{}, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+
+	return t, nil
+}
+
+// connectionIP is the peer address, nil for the unix socket peers
+func connectionIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return net.ParseIP(host)
+}
+
+func isUnixConnection(r *http.Request) bool {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+
+	return ok && addr.Network() == "unix"
+}
+
+// resolve returns the connection address or, for the trusted proxies, the nearest untrusted X-Forwarded-For hop
+func (t trustedProxies) resolve(r *http.Request) client {
+	c := client{ip: connectionIP(r)}
+
+	if c.ip != nil {
+		c.viaTrustedProxy = containsIP(t.networks, c.ip) != nil
+	} else {
+		c.viaTrustedProxy = t.unix && isUnixConnection(r)
+	}
+
+	if !c.viaTrustedProxy {
+		return c
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+
+		c.ip = hop
+
+		if containsIP(t.networks, hop) == nil {
+			break
+		}
+	}
+
+	return c
+}
+
+// clientMiddleware resolves the client of the request once for the access control, the mirror choice and the logs
+func (s Server) clientMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := s.proxies.resolve(r)
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientKey{}, c)))
+	})
+}
+
+func requestClient(r *http.Request) client {
+	if c, ok := r.Context().Value(clientKey{}).(client); ok {
+		return c
+	}
+
+	return client{ip: connectionIP(r)}
+}
+
+// clientIP returns the client address resolved by clientMiddleware, the connection one when it did not run
+func clientIP(r *http.Request) net.IP {
+	return requestClient(r).ip
+}
@@ -1,23 +1,25 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httputil"
 	"net/http/pprof"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.uber.org/zap"
 
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
 	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins"
-)
-
-const (
-	timeoutTotal = 15 * time.Second
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/metrics"
 )
 
 func (s Server) loggerMiddleware(next http.Handler) http.Handler {
@@ -26,9 +28,17 @@ func (s Server) loggerMiddleware(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
 
+		r, p := withPrincipal(r)
+
+		if name, ok := clientCertificateName(r); ok {
+			p.name = "cert " + name
+		}
+
 		t1 := time.Now()
 		defer func() {
 			l.Info("Served",
+				zap.String("principal", p.name),
+				zap.Stringer("clientIP", clientIP(r)),
 				zap.String("proto", r.Proto),
 				zap.String("method", r.Method),
 				zap.String("path", r.URL.Path),
@@ -103,62 +113,228 @@ func (s Server) httpProxy(proxyToURL string) (*httputil.ReverseProxy, error) {
 
 	return &httputil.ReverseProxy{
 		Director: director,
+		Transport: idleTimeoutTransport{
+			rt:      otelhttp.NewTransport(http.DefaultTransport.(*http.Transport).Clone()),
+			timeout: s.cfg.ArtifactIdleTimeout,
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			s.log.Errorf("cannot proxy %s: %v", req.URL.String(), err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
 	}, nil
 }
 
+func (s Server) mirrorRedirectHandler(w http.ResponseWriter, r *http.Request) {
+	mirrorURL, ok := s.mirrorPicker.Pick(clientIP(r))
+	if !ok {
+		s.log.Errorf("no healthy mirror to redirect %s to", r.URL.Path)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	target := mirrorURL + r.URL.EscapedPath()
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+func (s Server) mirrorAuditReportHandler(w http.ResponseWriter, _ *http.Request) {
+	report := s.mirrorAuditor.LastReport()
+	if report == nil {
+		http.Error(w, "mirror audit has not completed yet", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		s.log.Warnf("cannot write mirror audit report: %v", err)
+	}
+}
+
+// spanName names the server spans after the route group and the method, the path is recorded as an attribute
+func spanName(operation string, r *http.Request) string {
+	return operation + " " + r.Method
+}
+
+// feedMetricsMiddleware counts the served update center requests by status
+func feedMetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		defer func() {
+			metrics.FeedRequests.WithLabelValues(strconv.Itoa(ww.Status())).Inc()
+		}()
+
+		next.ServeHTTP(ww, r)
+	})
+}
+
+// proxiedBytesMiddleware counts the bytes of the proxied artifacts
+func proxiedBytesMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		defer func() {
+			metrics.ArtifactProxiedBytes.Add(float64(ww.BytesWritten()))
+		}()
+
+		next.ServeHTTP(ww, r)
+	}
+}
+
+// getAdminHandlers serves the operator endpoints, they are never exposed on the public listener
+func (s Server) getAdminHandlers() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Use(middleware.Heartbeat("/healthz"))
+
+	if s.updateCenter != nil {
+		r.Use(s.readinessMiddleware)
+	}
+
+	r.Use(s.clientMiddleware)
+	r.Use(s.loggerMiddleware)
+
+	// the signing API authenticates its callers with its own tokens
+	if s.signAPI != nil {
+		r.With(middleware.Recoverer).Post("/sign", s.signAPI.ServeHTTP)
+	}
+
+	r.Group(func(r chi.Router) {
+		if s.cfg.Admin.RequireAuth {
+			r.Use(s.adminAuthMiddleware)
+		}
+
+		r.HandleFunc("/debug/pprof/", pprof.Index)
+		r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+		r.Handle("/metrics", promhttp.Handler())
+
+		if s.mirrorAuditor != nil {
+			r.Get("/mirror-audit.json", s.mirrorAuditReportHandler)
+		}
+
+		if s.updateCenter != nil {
+			r.Get(statusPath, s.statusHandler)
+
+			if s.adminTokens != nil {
+				r.Group(func(r chi.Router) {
+					if !s.cfg.Admin.RequireAuth {
+						r.Use(s.adminAuthMiddleware)
+					}
+
+					r.Post(adminRefreshPath, s.refreshHandler)
+					r.Get(adminUpstreamPath, s.upstreamHandler)
+				})
+			}
+		}
+	})
+
+	return r
+}
+
+// getRedirectHandlers answers the health checks on the plain HTTP listeners and redirects the rest to HTTPS
+func (s Server) getRedirectHandlers(httpsPort string) *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Use(middleware.Heartbeat("/healthz"))
+
+	if s.updateCenter != nil {
+		r.Use(s.readinessMiddleware)
+	}
+
+	r.Use(s.clientMiddleware)
+	r.Use(s.loggerMiddleware)
+
+	r.Handle("/*", httpsRedirectHandler(httpsPublicURL(s.cfg.PublicURL), httpsPort))
+
+	return r
+}
+
+// getHandlers serves the feed and the downloads to Jenkins controllers
 func (s Server) getHandlers() (*chi.Mux, error) {
 	r := chi.NewRouter()
 
 	r.Use(middleware.Heartbeat("/healthz"))
 
+	if s.updateCenter != nil {
+		r.Use(s.readinessMiddleware)
+	}
+
+	r.Use(s.clientMiddleware)
 	r.Use(s.loggerMiddleware)
 
-	r.HandleFunc("/debug/pprof/", pprof.Index)
-	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
-	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
-	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
-	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	downloadHandler := s.mirrorRedirectHandler
 
-	proxy, err := s.httpProxy(s.proxyToURL)
-	if err != nil {
-		return nil, err
+	if s.cfg.DownloadMode != config.DownloadModeRedirect {
+		proxy, err := s.httpProxy(s.proxyToURL)
+		if err != nil {
+			return nil, err
+		}
+
+		downloadHandler = proxiedBytesMiddleware(proxy.ServeHTTP)
 	}
 
+	downloadHandler = otelhttp.NewHandler(http.HandlerFunc(downloadHandler), "artifact", otelhttp.WithSpanNameFormatter(spanName)).ServeHTTP
+
+	// the bootstrap files are public
 	r.Group(func(r chi.Router) {
-		r.Use(middleware.RealIP)
 		r.Use(middleware.Recoverer)
 
-		r.Use(middleware.Timeout(timeoutTotal))
+		r.Get(bootstrapRootCAPath, s.rootCAHandler)
+		r.Get(bootstrapUpdateCenterPath, s.updateCenterXMLHandler)
+		r.Get(bootstrapCasCPath, s.casCHandler)
+	})
 
-		r.Get("/*", proxy.ServeHTTP)
+	r.Group(func(r chi.Router) {
+		r.Use(s.accessMiddleware)
+		r.Use(middleware.Recoverer)
 
-		fsHandler := http.FileServer(http.Dir(s.dataDir))
+		// Artifacts can be large and are streamed without a total deadline, Range and If-Range headers
+		// are passed through, so interrupted downloads can be resumed
+		r.Get("/*", downloadHandler)
+		r.Head("/*", downloadHandler)
 
 		r.Group(func(r chi.Router) {
-			r.Use(func(next http.Handler) http.Handler {
-				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					if err := s.patchedFileProvider.RefreshContent(r.Context()); err != nil {
-						s.log.Errorf("failed to refresh content: %v", err)
-						w.WriteHeader(http.StatusInternalServerError)
-						return
-					}
-
-					next.ServeHTTP(w, r)
+			r.Use(middleware.Timeout(s.cfg.FeedTimeout))
+
+			fsHandler := http.FileServer(http.Dir(s.dataDir))
+
+			r.Group(func(r chi.Router) {
+				r.Use(otelhttp.NewMiddleware("feed", otelhttp.WithSpanNameFormatter(spanName)))
+				r.Use(feedMetricsMiddleware)
+				r.Use(func(next http.Handler) http.Handler {
+					return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						if err := s.patchedFileProvider.RefreshContent(r.Context()); err != nil {
+							s.log.Errorf("failed to refresh content: %v", err)
+							w.WriteHeader(http.StatusInternalServerError)
+							return
+						}
+
+						next.ServeHTTP(w, r)
+					})
 				})
-			})
+				r.Use(s.feedVariantMiddleware)
 
-			r.Get("/"+jenkins.UpdateCenterDotJSON, fsHandler.ServeHTTP)
-			r.Head("/"+jenkins.UpdateCenterDotJSON, fsHandler.ServeHTTP)
-			r.Get("/"+jenkins.UpdateCenterDotHTML, fsHandler.ServeHTTP)
-			r.Head("/"+jenkins.UpdateCenterDotHTML, fsHandler.ServeHTTP)
-		})
+				r.Get("/"+jenkins.UpdateCenterDotJSON, fsHandler.ServeHTTP)
+				r.Head("/"+jenkins.UpdateCenterDotJSON, fsHandler.ServeHTTP)
+				r.Get("/"+jenkins.UpdateCenterDotHTML, fsHandler.ServeHTTP)
+				r.Head("/"+jenkins.UpdateCenterDotHTML, fsHandler.ServeHTTP)
+			})
 
-		r.Get("/updates/hudson.tasks.*", func(w http.ResponseWriter, _ *http.Request) {
-			w.WriteHeader(http.StatusNotFound)
-		})
+			r.Get("/updates/hudson.tasks.*", func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			})
 
-		r.Get("/updates/hudson.tools.*", func(w http.ResponseWriter, _ *http.Request) {
-			w.WriteHeader(http.StatusNotFound)
+			r.Get("/updates/hudson.tools.*", func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			})
 		})
 	})
 
@@ -0,0 +1,332 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/mirror"
+)
+
+func newProxyServer(t *testing.T, upstream string, idleTimeout time.Duration) *httptest.Server {
+	t.Helper()
+
+	logger, _ := zap.NewDevelopment()
+
+	s := Server{
+		log: logger.Sugar(),
+		cfg: config.ServerConfig{
+			ArtifactIdleTimeout: idleTimeout,
+		},
+	}
+
+	proxy, err := s.httpProxy(upstream)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return httptest.NewServer(proxy)
+}
+
+func TestProxyRange(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 100))
+	modTime := time.Date(2024, 8, 18, 0, 0, 0, 0, time.UTC)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"jenkins-war"`)
+		http.ServeContent(w, r, "jenkins.war", modTime, bytes.NewReader(content))
+	}))
+	defer upstream.Close()
+
+	proxy := newProxyServer(t, upstream.URL, time.Second)
+	defer proxy.Close()
+
+	cases := map[string]struct {
+		ifRange    string
+		statusCode int
+		body       []byte
+	}{
+		"range":             {statusCode: http.StatusPartialContent, body: content[10:20]},
+		"if-range-matching": {ifRange: `"jenkins-war"`, statusCode: http.StatusPartialContent, body: content[10:20]},
+		"if-range-changed":  {ifRange: `"other"`, statusCode: http.StatusOK, body: content},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, proxy.URL+"/war/2.472/jenkins.war", http.NoBody)
+			req.Header.Set("Range", "bytes=10-19")
+			if test.ifRange != "" {
+				req.Header.Set("If-Range", test.ifRange)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != test.statusCode || !bytes.Equal(body, test.body) {
+				t.Fatalf("unexpected response: %d, %d bytes", resp.StatusCode, len(body))
+			}
+		})
+	}
+}
+
+func TestProxyIdleTimeout(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "10")
+
+		for i := 0; i < 5; i++ {
+			_, _ = w.Write([]byte("x"))
+			w.(http.Flusher).Flush()
+
+			delay := 50 * time.Millisecond
+			if r.URL.Path == "/stalled" && i == 2 {
+				delay = time.Second
+			}
+
+			time.Sleep(delay)
+		}
+
+		_, _ = w.Write([]byte("xxxxx"))
+	}))
+	defer upstream.Close()
+
+	proxy := newProxyServer(t, upstream.URL, 200*time.Millisecond)
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL + "/slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	if err != nil || len(body) != 10 {
+		t.Fatalf("slow but progressing download is interrupted: %d bytes, %v", len(body), err)
+	}
+
+	resp, err = http.Get(proxy.URL + "/stalled")
+	if err != nil {
+		// the proxy aborted the response before flushing the headers
+		return
+	}
+
+	body, err = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	if err == nil && len(body) == 10 {
+		t.Fatal("stalled download is not interrupted")
+	}
+}
+
+func TestIdleTimeoutTransport(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(bytes.Repeat([]byte("x"), 1<<20))
+	}))
+	defer upstream.Close()
+
+	for _, timeout := range []time.Duration{0, 100 * time.Millisecond} {
+		rt := idleTimeoutTransport{rt: http.DefaultTransport, timeout: timeout}
+
+		req, _ := http.NewRequest(http.MethodGet, upstream.URL, http.NoBody)
+
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("timeout %s: %v", timeout, err)
+		}
+
+		// a slow client does not make the upstream idle
+		buf := make([]byte, 1024)
+		if _, err := io.ReadFull(resp.Body, buf); err != nil {
+			t.Fatal(err)
+		}
+
+		time.Sleep(300 * time.Millisecond)
+
+		rest, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+
+		if err != nil || len(rest) != 1<<20-len(buf) {
+			t.Fatalf("timeout %s: download interrupted after %d bytes: %v", timeout, len(buf)+len(rest), err)
+		}
+	}
+}
+
+type staticRefresher struct{}
+
+func (staticRefresher) RefreshContent(_ context.Context) error {
+	return nil
+}
+
+func TestMetrics(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+
+	dataDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dataDir, jenkins.UpdateCenterDotJSON), []byte("updateCenter.post(\n{}\n);"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := Server{
+		log:                 logger.Sugar(),
+		cfg:                 config.ServerConfig{DownloadMode: config.DownloadModeRedirect, FeedTimeout: time.Second},
+		patchedFileProvider: staticRefresher{},
+		dataDir:             dataDir,
+	}
+
+	handlers, err := s.getHandlers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(handlers)
+	defer srv.Close()
+
+	adminSrv := httptest.NewServer(s.getAdminHandlers())
+	defer adminSrv.Close()
+
+	get := func(path string) string {
+		resp, err := http.Get(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+
+		return string(body)
+	}
+
+	// the counters are global, so other tests may have counted already
+	served := func() float64 {
+		for _, line := range strings.Split(get(adminSrv.URL+"/metrics"), "\n") {
+			if value, ok := strings.CutPrefix(line, `resigner_feed_requests_total{status="200"} `); ok {
+				v, _ := strconv.ParseFloat(value, 64)
+				return v
+			}
+		}
+
+		return 0
+	}
+
+	before := served()
+
+	get(srv.URL + "/" + jenkins.UpdateCenterDotJSON)
+
+	if after := served(); after-before != 1 {
+		t.Fatalf("served feed request is counted %v times", after-before)
+	}
+}
+
+func TestMirrorRedirect(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+
+	var dc1Down atomic.Bool
+
+	health := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/dc1") && dc1Down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer health.Close()
+
+	pool, err := mirror.NewPool(logger.Sugar(), config.RedirectConfig{
+		Mirrors: []string{
+			health.URL + "/dc1,subnet=10.1.0.0/16",
+			health.URL + "/global",
+		},
+		HealthCheckPath:    "/",
+		HealthCheckTimeout: 5 * time.Second,
+		UnhealthyThreshold: 1,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool.CheckHealth(context.Background())
+
+	proxies, err := newTrustedProxies([]string{"192.168.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := Server{
+		log:          logger.Sugar(),
+		cfg:          config.ServerConfig{DownloadMode: config.DownloadModeRedirect, FeedTimeout: time.Second},
+		mirrorPicker: pool,
+		proxies:      proxies,
+	}
+
+	handlers, err := s.getHandlers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	redirect := func(remoteAddr, forwardedFor string) (int, string) {
+		req := httptest.NewRequest(http.MethodGet, "/plugins/a.hpi?x=1", nil)
+		req.RemoteAddr = remoteAddr
+
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+
+		rec := httptest.NewRecorder()
+		handlers.ServeHTTP(rec, req)
+
+		return rec.Code, rec.Header().Get("Location")
+	}
+
+	for _, tt := range []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		mirror       string
+	}{
+		{name: "mirror subnet", remoteAddr: "10.1.2.3:1234", mirror: "/dc1"},
+		{name: "other client", remoteAddr: "172.16.0.1:1234", mirror: "/global"},
+		{name: "trusted proxy", remoteAddr: "192.168.0.1:1234", forwardedFor: "10.1.2.3", mirror: "/dc1"},
+		{name: "spoofed forwarded address", remoteAddr: "172.16.0.1:1234", forwardedFor: "10.1.2.3", mirror: "/global"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				code, location := redirect(tt.remoteAddr, tt.forwardedFor)
+				if code != http.StatusFound || location != health.URL+tt.mirror+"/plugins/a.hpi?x=1" {
+					t.Fatalf("returned %d redirecting to %q", code, location)
+				}
+			}
+		})
+	}
+
+	dc1Down.Store(true)
+	pool.CheckHealth(context.Background())
+
+	if _, location := redirect("10.1.2.3:1234", ""); location != health.URL+"/global/plugins/a.hpi?x=1" {
+		t.Fatalf("client of the unhealthy mirror redirected to %q", location)
+	}
+
+	health.Close()
+	pool.CheckHealth(context.Background())
+
+	if code, _ := redirect("10.1.2.3:1234", ""); code != http.StatusServiceUnavailable {
+		t.Fatalf("returned %d without healthy mirrors", code)
+	}
+}
@@ -0,0 +1,343 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/go-systemd/v22/activation"
+)
+
+const (
+	listenHTTP    = "http"
+	listenUnix    = "unix"
+	listenSystemd = "systemd"
+
+	httpsSuffix = "+https"
+)
+
+// listenSpec is a public listener, the address is host:port, the socket path or the systemd socket name
+type listenSpec struct {
+	spec    string
+	network string
+	address string
+	tls     bool
+}
+
+// parseListenSpec parses http://[host]:port, https://[host]:port, unix:///path and systemd://[name] listeners,
+// unix+https:// and systemd+https:// serve TLS
+func parseListenSpec(spec string) (listenSpec, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return listenSpec{}, fmt.Errorf("listener %q is incorrect: %w", spec, err)
+	}
+
+	l := listenSpec{spec: spec}
+
+	scheme, tls := strings.CutSuffix(u.Scheme, httpsSuffix)
+	if u.Scheme == "https" {
+		scheme, tls = listenHTTP, true
+	} else if tls && scheme == listenHTTP {
+		return listenSpec{}, fmt.Errorf("listener %q has unknown scheme %q, use https://", spec, u.Scheme)
+	}
+
+	l.tls = tls
+
+	switch scheme {
+	case listenHTTP:
+		if _, port, err := net.SplitHostPort(u.Host); err != nil || port == "" {
+			return listenSpec{}, fmt.Errorf("listener %q has no port", spec)
+		}
+
+		l.network, l.address = "tcp", u.Host
+	case listenUnix:
+		if u.Path == "" {
+			return listenSpec{}, fmt.Errorf("listener %q has no socket path", spec)
+		}
+
+		l.network, l.address = listenUnix, u.Path
+	case listenSystemd:
+		l.network, l.address = listenSystemd, u.Host
+	default:
+		return listenSpec{}, fmt.Errorf("listener %q has unknown scheme %q", spec, u.Scheme)
+	}
+
+	return l, nil
+}
+
+// takesSystemdRest tells the systemd:// listener, which takes the activated sockets no other listener is named after
+func (l listenSpec) takesSystemdRest() bool {
+	return l.network == listenSystemd && l.address == ""
+}
+
+// bindOrder binds the systemd:// listener last, so the named ones get their sockets whatever order they are given in
+func bindOrder(specs []listenSpec) []listenSpec {
+	ordered := make([]listenSpec, 0, len(specs))
+
+	for _, l := range specs {
+		if !l.takesSystemdRest() {
+			ordered = append(ordered, l)
+		}
+	}
+
+	for _, l := range specs {
+		if l.takesSystemdRest() {
+			ordered = append(ordered, l)
+		}
+	}
+
+	return ordered
+}
+
+// parseListenSpecs returns the --listen listeners or the single --listen-addr and --listen-port one,
+// which serves TLS when the certificate is configured
+func (s Server) parseListenSpecs() ([]listenSpec, error) {
+	if len(s.cfg.Listen) == 0 {
+		return []listenSpec{{
+			spec:    net.JoinHostPort(s.cfg.ListenAddr, strconv.Itoa(s.cfg.ListenPort)),
+			network: "tcp",
+			address: net.JoinHostPort(s.cfg.ListenAddr, strconv.Itoa(s.cfg.ListenPort)),
+			tls:     s.cfg.TLSCertPath != "",
+		}}, nil
+	}
+
+	var (
+		specs    = make([]listenSpec, 0, len(s.cfg.Listen))
+		takeRest string
+	)
+
+	for _, spec := range s.cfg.Listen {
+		l, err := parseListenSpec(strings.TrimSpace(spec))
+		if err != nil {
+			return nil, err
+		}
+
+		if l.tls && s.cfg.TLSCertPath == "" {
+			return nil, fmt.Errorf("listener %q requires the TLS certificate and key", spec)
+		}
+
+		if l.takesSystemdRest() {
+			if takeRest != "" {
+				return nil, fmt.Errorf("listeners %q and %q both take the unnamed systemd sockets", takeRest, spec)
+			}
+
+			takeRest = spec
+		}
+
+		specs = append(specs, l)
+	}
+
+	return specs, nil
+}
+
+// httpsPort is the port of the first TCP HTTPS listener, empty for the default one, the unix and systemd ones
+// have no port the clients could be redirected to
+func httpsPort(specs []listenSpec) (string, bool) {
+	for _, l := range specs {
+		if !l.tls || l.network != "tcp" {
+			continue
+		}
+
+		if _, port, _ := net.SplitHostPort(l.address); port != "443" {
+			return port, true
+		}
+
+		return "", true
+	}
+
+	return "", false
+}
+
+// httpsPublicURL returns the --public-url the clients are redirected to, empty when it is not an HTTPS one
+func httpsPublicURL(publicURL string) string {
+	if u, err := url.Parse(publicURL); err != nil || u.Scheme != "https" || u.Host == "" {
+		return ""
+	}
+
+	return strings.TrimSuffix(publicURL, "/")
+}
+
+// httpsRedirectHandler sends the plain HTTP clients to the same URL under the HTTPS public URL or, when it is not
+// configured, on the HTTPS listener port of the requested host
+func httpsRedirectHandler(publicURL, port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicURL != "" {
+			target := publicURL + r.URL.EscapedPath()
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+
+			http.Redirect(w, r, target, http.StatusPermanentRedirect)
+
+			return
+		}
+
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		if port != "" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		target := url.URL{Scheme: "https", Host: host, Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery}
+
+		http.Redirect(w, r, target.String(), http.StatusPermanentRedirect)
+	})
+}
+
+// listenUnixSocket replaces the stale socket left by the previous run, a socket somebody listens on is kept
+func listenUnixSocket(path, mode string) (net.Listener, error) {
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("unix socket mode %q is incorrect: %w", mode, err)
+	}
+
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial(listenUnix, path); err == nil {
+			_ = conn.Close()
+
+			return nil, fmt.Errorf("socket %s is in use", path)
+		}
+
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("cannot remove stale socket: %w", err)
+		}
+	}
+
+	l, err := net.Listen(listenUnix, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, os.FileMode(perm)); err != nil {
+		_ = l.Close()
+
+		return nil, fmt.Errorf("cannot change socket permissions: %w", err)
+	}
+
+	return l, nil
+}
+
+// systemdListeners hands the activated sockets out by their FileDescriptorName=, an empty name takes all the rest,
+// so it is taken after the named ones
+type systemdListeners struct {
+	byName map[string][]net.Listener
+}
+
+func (a *systemdListeners) take(name string) ([]net.Listener, error) {
+	if a.byName == nil {
+		byName, err := activation.ListenersWithNames()
+		if err != nil {
+			return nil, fmt.Errorf("cannot use systemd activated sockets: %w", err)
+		}
+
+		a.byName = byName
+	}
+
+	var taken []net.Listener
+
+	for socketName, listeners := range a.byName {
+		if name != "" && socketName != name {
+			continue
+		}
+
+		for _, l := range listeners {
+			// the activated datagram sockets are not listeners
+			if l != nil {
+				taken = append(taken, l)
+			}
+		}
+
+		delete(a.byName, socketName)
+	}
+
+	if len(taken) == 0 {
+		return nil, fmt.Errorf("no systemd activated socket named %q", name)
+	}
+
+	return taken, nil
+}
+
+// close releases the activated sockets no listener was configured for
+func (a *systemdListeners) close() []string {
+	var names []string
+
+	for name, listeners := range a.byName {
+		for _, l := range listeners {
+			if l != nil {
+				_ = l.Close()
+			}
+		}
+
+		names = append(names, name)
+	}
+
+	return names
+}
+
+type boundListener struct {
+	listenSpec
+	net.Listener
+}
+
+// openListeners binds all the public listeners, none is left open on error
+func (s Server) openListeners() ([]boundListener, error) {
+	var (
+		bound   []boundListener
+		systemd systemdListeners
+		err     error
+	)
+
+	for _, spec := range bindOrder(s.listens) {
+		var listeners []net.Listener
+
+		switch spec.network {
+		case listenSystemd:
+			listeners, err = systemd.take(spec.address)
+		case listenUnix:
+			var l net.Listener
+			if l, err = listenUnixSocket(spec.address, s.cfg.UnixSocketMode); err == nil {
+				listeners = append(listeners, l)
+			}
+		default:
+			var l net.Listener
+			if l, err = net.Listen(spec.network, spec.address); err == nil {
+				listeners = append(listeners, l)
+			}
+		}
+
+		if err != nil {
+			err = fmt.Errorf("cannot listen on %s: %w", spec.spec, err)
+
+			break
+		}
+
+		for _, l := range listeners {
+			bound = append(bound, boundListener{listenSpec: spec, Listener: l})
+		}
+	}
+
+	if unused := systemd.close(); len(unused) > 0 {
+		s.log.Warnf("systemd activated sockets %v are not configured as listeners and closed", unused)
+	}
+
+	if err != nil {
+		var errs []error
+		for _, l := range bound {
+			errs = append(errs, l.Close())
+		}
+
+		return nil, errors.Join(append([]error{err}, errs...)...)
+	}
+
+	return bound, nil
+}
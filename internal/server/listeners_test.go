@@ -0,0 +1,240 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+)
+
+func TestParseListenSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    listenSpec
+		wantErr bool
+	}{
+		{spec: "http://:8080", want: listenSpec{network: "tcp", address: ":8080"}},
+		{spec: "https://[::1]:8443", want: listenSpec{network: "tcp", address: "[::1]:8443", tls: true}},
+		{spec: "unix:///run/resigner.sock", want: listenSpec{network: "unix", address: "/run/resigner.sock"}},
+		{spec: "unix+https:///run/resigner.sock", want: listenSpec{network: "unix", address: "/run/resigner.sock", tls: true}},
+		{spec: "systemd://", want: listenSpec{network: "systemd"}},
+		{spec: "systemd+https://public", want: listenSpec{network: "systemd", address: "public", tls: true}},
+		{spec: "http://localhost", wantErr: true},
+		{spec: "unix://", wantErr: true},
+		{spec: "ftp://:21", wantErr: true},
+		{spec: "http+https://:8443", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseListenSpec(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseListenSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			tt.want.spec = tt.spec
+			if got != tt.want {
+				t.Errorf("parseListenSpec() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSystemdListeners(t *testing.T) {
+	listen := func() net.Listener {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() { _ = l.Close() })
+
+		return l
+	}
+
+	public, internal := listen(), listen()
+
+	s := Server{cfg: config.ServerConfig{
+		Listen:      []string{"systemd://", "systemd+https://public", "systemd+https://"},
+		TLSCertPath: "tls.crt",
+	}}
+
+	if _, err := s.parseListenSpecs(); err == nil {
+		t.Fatal("two listeners taking the unnamed systemd sockets accepted")
+	}
+
+	s.cfg.Listen = s.cfg.Listen[:2]
+
+	specs, err := s.parseListenSpecs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the named socket goes to its listener even when the unnamed ones are listed first
+	systemd := systemdListeners{byName: map[string][]net.Listener{"public": {public}, "internal": {internal}}}
+	taken := map[string][]net.Listener{}
+
+	for _, spec := range bindOrder(specs) {
+		listeners, err := systemd.take(spec.address)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		taken[spec.spec] = listeners
+	}
+
+	if len(taken["systemd+https://public"]) != 1 || taken["systemd+https://public"][0] != public ||
+		len(taken["systemd://"]) != 1 || taken["systemd://"][0] != internal {
+		t.Fatalf("unexpected systemd sockets taken %v", taken)
+	}
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	port, ok := httpsPort([]listenSpec{
+		{network: "tcp", address: ":8080"},
+		{network: "unix", address: "/run/resigner.sock", tls: true},
+		{network: "tcp", address: ":8443", tls: true},
+	})
+	if !ok || port != "8443" {
+		t.Fatalf("httpsPort() = %q, %v", port, ok)
+	}
+
+	if _, ok := httpsPort([]listenSpec{{network: "unix", address: "/run/resigner.sock", tls: true}}); ok {
+		t.Fatal("unix socket listener taken for the HTTPS port")
+	}
+
+	if port, ok := httpsPort([]listenSpec{{network: "tcp", address: ":443", tls: true}}); !ok || port != "" {
+		t.Fatalf("httpsPort() = %q, %v for the default port", port, ok)
+	}
+
+	if _, ok := httpsPort([]listenSpec{{network: "tcp", address: ":8080"}}); ok {
+		t.Fatal("HTTPS listener found among plain ones")
+	}
+
+	logger, _ := zap.NewDevelopment()
+
+	handlers := Server{log: logger.Sugar()}.getRedirectHandlers("8443")
+
+	for path, want := range map[string]string{
+		"/update-center.json?id=default": "https://updates.local:8443/update-center.json?id=default",
+		"/healthz":                       "",
+	} {
+		w := httptest.NewRecorder()
+		handlers.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://updates.local:8080"+path, nil))
+
+		if got := w.Header().Get("Location"); got != want {
+			t.Errorf("%s redirected to %q, want %q", path, got, want)
+		}
+	}
+
+	public := Server{log: logger.Sugar(), cfg: config.ServerConfig{PublicURL: "https://updates.example.com/"}}.getRedirectHandlers("")
+
+	w := httptest.NewRecorder()
+	public.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://attacker.example:8080/update-center.json?id=default", nil))
+
+	if got := w.Header().Get("Location"); got != "https://updates.example.com/update-center.json?id=default" {
+		t.Errorf("redirected to %q instead of the public URL", got)
+	}
+}
+
+func TestListeners(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+
+	socketPath := filepath.Join(t.TempDir(), "resigner.sock")
+
+	// a stale socket of the previous run is replaced
+	stale, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	s := Server{
+		log: logger.Sugar(),
+		cfg: config.ServerConfig{UnixSocketMode: "0600"},
+		srv: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte("served"))
+		})},
+		// only the TCP listeners are redirected
+		redirectSrv: &http.Server{Handler: httpsRedirectHandler("https://updates.example.com", "")},
+	}
+
+	for _, spec := range []string{"http://127.0.0.1:0", "unix://" + socketPath} {
+		l, err := parseListenSpec(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s.listens = append(s.listens, l)
+	}
+
+	listeners, err := s.openListeners()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.srv.Close()
+	defer s.redirectSrv.Close()
+
+	for _, l := range listeners {
+		go func() {
+			_ = s.serveListener(l)
+		}()
+	}
+
+	if fi, err := os.Stat(socketPath); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("socket permissions are not applied: %v", err)
+	}
+
+	noRedirect := func(_ *http.Request, _ []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	clients := map[string]struct {
+		client *http.Client
+		status int
+	}{
+		"http://" + listeners[0].Addr().String(): {&http.Client{CheckRedirect: noRedirect}, http.StatusPermanentRedirect},
+		"http://unix": {&http.Client{CheckRedirect: noRedirect, Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+			},
+		}}, http.StatusOK},
+	}
+
+	for url, c := range clients {
+		resp, err := c.client.Get(url + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != c.status {
+			t.Errorf("%s returned %d, want %d", url, resp.StatusCode, c.status)
+		}
+	}
+
+	if _, err := s.openListeners(); err == nil {
+		t.Fatal("socket in use replaced")
+	}
+
+	s.listens = []listenSpec{{spec: "systemd://missing", network: "systemd", address: "missing"}}
+
+	if _, err := s.openListeners(); err == nil {
+		t.Fatal("missing systemd socket accepted")
+	}
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins"
+)
+
+// requestHostURL is the profile URL deriving the download URL from the request
+const requestHostURL = "request-host"
+
+// FeedVariantProvider is implemented by the update centers able to serve the feed patched for other download URLs
+type FeedVariantProvider interface {
+	GetVariant(ctx context.Context, downloadURL string) (*jenkins.Variant, error)
+}
+
+// mirrorProfile points the downloads of the matching clients to its own mirror
+type mirrorProfile struct {
+	name string
+	// downloadURL is empty when it is derived from the request
+	downloadURL string
+	// hosts are the Host headers served, with the port the ones matching the port too
+	hosts    []string
+	networks []*net.IPNet
+}
+
+// parseMirrorProfile parses NAME=URL[,subnet=CIDR...][,host=HOST...] mirror profile specification
+func parseMirrorProfile(spec string) (*mirrorProfile, error) {
+	parts := strings.Split(spec, ",")
+
+	name, u, ok := strings.Cut(strings.TrimSpace(parts[0]), "=")
+	if !ok || name == "" {
+		return nil, fmt.Errorf("mirror profile %q is not NAME=URL", spec)
+	}
+
+	p := &mirrorProfile{name: name}
+
+	if u != requestHostURL {
+		if _, err := url.ParseRequestURI(u); err != nil {
+			return nil, fmt.Errorf("mirror profile %s URL %q is incorrect: %w", name, u, err)
+		}
+
+		p.downloadURL = strings.TrimSuffix(u, "/")
+	}
+
+	for _, part := range parts[1:] {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("mirror profile %s option %q is not a key=value pair", name, part)
+		}
+
+		switch key {
+		case "subnet":
+			networks, err := parseNetworks([]string{value})
+			if err != nil {
+				return nil, fmt.Errorf("mirror profile %s: %w", name, err)
+			}
+
+			p.networks = append(p.networks, networks...)
+		case "host":
+			p.hosts = append(p.hosts, strings.ToLower(value))
+		default:
+			return nil, fmt.Errorf("unknown mirror profile %s option %q", name, key)
+		}
+	}
+
+	if p.downloadURL == "" && len(p.hosts) == 0 {
+		return nil, fmt.Errorf("mirror profile %s derives the download URL from the request host and needs the hosts it serves", name)
+	}
+
+	return p, nil
+}
+
+// servesHost matches the Host header against the profile hosts
+func (p *mirrorProfile) servesHost(host string) bool {
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+
+	for _, h := range p.hosts {
+		if strings.EqualFold(h, hostname) || strings.EqualFold(h, host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// signsForHost tells whether the request host may be signed into the downloads, only the listed hosts are, so
+// the clients cannot get the feed signed for any URL or use the variants up
+func (p *mirrorProfile) signsForHost(host string) bool {
+	for _, h := range p.hosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newMirrorProfiles(cfg config.MirrorProfilesConfig) ([]*mirrorProfile, error) {
+	profiles := make([]*mirrorProfile, 0, len(cfg.Profiles))
+	names := map[string]bool{}
+
+	for _, spec := range cfg.Profiles {
+		p, err := parseMirrorProfile(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		if names[p.name] {
+			return nil, fmt.Errorf("mirror profile %s is defined twice", p.name)
+		}
+
+		names[p.name] = true
+		profiles = append(profiles, p)
+	}
+
+	return profiles, nil
+}
+
+// selectProfile picks the profile named in the query parameter, then the one serving the Host header and then
+// the one serving the client subnet, nil selects the default feed
+func (s Server) selectProfile(r *http.Request) (*mirrorProfile, error) {
+	if name := r.URL.Query().Get(s.cfg.MirrorProfiles.QueryParam); name != "" {
+		for _, p := range s.profiles {
+			if p.name == name {
+				return p, nil
+			}
+		}
+
+		return nil, fmt.Errorf("unknown mirror profile %q", name)
+	}
+
+	for _, p := range s.profiles {
+		if p.servesHost(r.Host) {
+			return p, nil
+		}
+	}
+
+	if ip := clientIP(r); ip != nil {
+		for _, p := range s.profiles {
+			if containsIP(p.networks, ip) != nil {
+				return p, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// feedVariantMiddleware serves the feed variant of the selected mirror profile instead of the default feed
+func (s Server) feedVariantMiddleware(next http.Handler) http.Handler {
+	variants, ok := s.patchedFileProvider.(FeedVariantProvider)
+	if !ok || len(s.profiles) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		profile, err := s.selectProfile(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if profile == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		downloadURL := profile.downloadURL
+		if downloadURL == "" {
+			if !profile.signsForHost(r.Host) {
+				http.Error(w, fmt.Sprintf("host %q is not served by mirror profile %s", r.Host, profile.name), http.StatusBadRequest)
+				return
+			}
+
+			downloadURL = requestBaseURL(r)
+		}
+
+		v, err := variants.GetVariant(r.Context(), downloadURL)
+		if errors.Is(err, jenkins.ErrTooManyVariants) {
+			s.log.Warnf("serving default feed to mirror profile %s: %v", profile.name, err)
+
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		if err != nil {
+			s.log.Errorf("mirror profile %s: %v", profile.name, err)
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		name := path.Base(r.URL.Path)
+
+		http.ServeContent(w, r, name, v.SignedAt, bytes.NewReader(v.Files[name]))
+	})
+}
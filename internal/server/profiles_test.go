@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins"
+)
+
+type fakeVariants struct {
+	// rejected is the download URL over the variants limit
+	rejected string
+	// signed are the download URLs variants were asked for
+	signed map[string]bool
+}
+
+func (fakeVariants) RefreshContent(_ context.Context) error {
+	return nil
+}
+
+func (f fakeVariants) GetVariant(_ context.Context, downloadURL string) (*jenkins.Variant, error) {
+	f.signed[downloadURL] = true
+
+	if downloadURL == f.rejected {
+		return nil, jenkins.ErrTooManyVariants
+	}
+
+	return &jenkins.Variant{
+		DownloadURL: downloadURL,
+		SignedAt:    time.Now(),
+		Files:       map[string][]byte{jenkins.UpdateCenterDotJSON: []byte(downloadURL)},
+	}, nil
+}
+
+func TestMirrorProfiles(t *testing.T) {
+	for _, spec := range []string{"https://dc1.mirror", "dc1=mirror", "local=request-host", "dc1=https://dc1.mirror,subnet=10.1.0.0/33", "dc1=https://dc1.mirror,weight=1"} {
+		if _, err := parseMirrorProfile(spec); err == nil {
+			t.Errorf("mirror profile %q accepted", spec)
+		}
+	}
+
+	cfg := config.MirrorProfilesConfig{
+		Profiles: []string{
+			"dc1=https://dc1.mirror/jenkins/,subnet=10.1.0.0/16",
+			"dc2=https://dc2.mirror,host=updates.dc2.local,subnet=10.2.0.0/16",
+			"local=request-host,host=localhost:8282,host=localhost:18282",
+		},
+		QueryParam: "mirror",
+	}
+
+	if _, err := newMirrorProfiles(config.MirrorProfilesConfig{Profiles: []string{cfg.Profiles[0], cfg.Profiles[0]}}); err == nil {
+		t.Fatal("duplicate mirror profile accepted")
+	}
+
+	profiles, err := newMirrorProfiles(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger, _ := zap.NewDevelopment()
+
+	variants := fakeVariants{rejected: "http://localhost:18282", signed: map[string]bool{}}
+
+	s := Server{
+		log:                 logger.Sugar(),
+		cfg:                 config.ServerConfig{MirrorProfiles: cfg},
+		patchedFileProvider: variants,
+		profiles:            profiles,
+	}
+
+	handler := s.feedVariantMiddleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("default"))
+	}))
+
+	tests := []struct {
+		name       string
+		url        string
+		remoteAddr string
+		header     http.Header
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "no profile", url: "http://updates.local/update-center.json", remoteAddr: "10.3.0.1:1234", wantStatus: http.StatusOK, wantBody: "default"},
+		{name: "subnet", url: "http://updates.local/update-center.json", remoteAddr: "10.1.2.3:1234", wantStatus: http.StatusOK, wantBody: "https://dc1.mirror/jenkins"},
+		{name: "host before subnet", url: "http://updates.dc2.local:8282/update-center.json", remoteAddr: "10.1.2.3:1234", wantStatus: http.StatusOK, wantBody: "https://dc2.mirror"},
+		{name: "query before host", url: "http://updates.dc2.local/update-center.json?id=default&mirror=dc1", remoteAddr: "10.3.0.1:1234", wantStatus: http.StatusOK, wantBody: "https://dc1.mirror/jenkins"},
+		{name: "unknown profile", url: "http://updates.local/update-center.json?mirror=dc3", remoteAddr: "10.3.0.1:1234", wantStatus: http.StatusBadRequest},
+		{name: "request host", url: "http://localhost:8282/update-center.json", remoteAddr: "127.0.0.1:1234", wantStatus: http.StatusOK, wantBody: "http://localhost:8282"},
+		{
+			name:       "untrusted forwarded proto",
+			url:        "http://localhost:8282/update-center.json",
+			remoteAddr: "127.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-Proto": {"https"}},
+			wantStatus: http.StatusOK,
+			wantBody:   "http://localhost:8282",
+		},
+		{name: "forged request host", url: "http://attacker.example/update-center.json?mirror=local", remoteAddr: "10.3.0.1:1234", wantStatus: http.StatusBadRequest},
+		{name: "unlisted request port", url: "http://localhost:1/update-center.json", remoteAddr: "127.0.0.1:1234", wantStatus: http.StatusOK, wantBody: "default"},
+		{name: "too many variants", url: "http://localhost:18282/update-center.json", remoteAddr: "127.0.0.1:1234", wantStatus: http.StatusOK, wantBody: "default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			r.RemoteAddr = tt.remoteAddr
+
+			for k, v := range tt.header {
+				r.Header[k] = v
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			if body, _ := io.ReadAll(w.Body); tt.wantBody != "" && string(body) != tt.wantBody {
+				t.Errorf("served %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+
+	for _, forged := range []string{"http://attacker.example", "http://localhost:1"} {
+		if variants.signed[forged] {
+			t.Errorf("variant signed for the forged host %s", forged)
+		}
+	}
+}
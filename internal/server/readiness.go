@@ -0,0 +1,92 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins"
+)
+
+const readinessPath = "/readyz"
+
+type readinessCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type readinessReport struct {
+	Ready  bool             `json:"ready"`
+	Checks []readinessCheck `json:"checks"`
+}
+
+func (r *readinessReport) add(name string, ok bool, detail string) {
+	r.Checks = append(r.Checks, readinessCheck{Name: name, OK: ok, Detail: detail})
+	r.Ready = r.Ready && ok
+}
+
+// generatedAt returns the upstream generation time, the fetch time when the upstream timestamp is not parsable
+func generatedAt(generation *jenkins.Generation) time.Time {
+	if t, err := time.Parse(time.RFC3339, generation.GenerationTimestamp); err == nil {
+		return t
+	}
+
+	return generation.FetchedAt
+}
+
+// readiness runs the configured checks against the update center status
+func (s Server) readiness(now time.Time) readinessReport {
+	var (
+		cfg    = s.cfg.Readiness
+		status = s.updateCenter.Status()
+		report = readinessReport{Ready: true}
+	)
+
+	if status.Current == nil {
+		report.add("generation", false, "no generation has been published yet")
+	} else {
+		report.add("generation", true, status.Current.GenerationTimestamp)
+
+		if cfg.MaxFeedAge > 0 {
+			age := now.Sub(generatedAt(status.Current)).Truncate(time.Second)
+			report.add("feed age", age <= cfg.MaxFeedAge, fmt.Sprintf("%s, %s at most", age, cfg.MaxFeedAge))
+		}
+	}
+
+	if cfg.MaxRefreshFailures > 0 {
+		report.add("refresh failures", status.ConsecutiveFailures < cfg.MaxRefreshFailures,
+			fmt.Sprintf("%d consecutive, not ready at %d", status.ConsecutiveFailures, cfg.MaxRefreshFailures))
+	}
+
+	if cfg.RequireValidCertificate && s.certificates != nil {
+		info := s.certificates.CertificateInfo()
+		report.add("signing certificate", !info.Expired, fmt.Sprintf("valid between %s and %s", info.NotBefore, info.NotAfter))
+	}
+
+	return report
+}
+
+// readinessHandler answers 503 while the service should not get the traffic
+func (s Server) readinessHandler(w http.ResponseWriter, _ *http.Request) {
+	report := s.readiness(time.Now())
+
+	if !report.Ready {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	s.writeJSON(w, report)
+}
+
+// readinessMiddleware answers the readiness probes before the logging and the authentication, like the heartbeat
+func (s Server) readinessMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method == http.MethodGet || r.Method == http.MethodHead) && r.URL.Path == readinessPath {
+			s.readinessHandler(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
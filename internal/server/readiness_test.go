@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/signer"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/sourcefileproviders"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/sourcefileproviders/localfile"
+)
+
+type staticCertificate signer.CertificateInfo
+
+func (c staticCertificate) CertificateInfo() signer.CertificateInfo {
+	return signer.CertificateInfo(c)
+}
+
+func TestReadiness(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+
+	now := time.Date(2024, 8, 18, 12, 0, 0, 0, time.UTC)
+	fresh := &jenkins.Generation{GenerationTimestamp: "2024-08-18T11:00:00Z"}
+
+	tests := []struct {
+		name        string
+		status      jenkins.Status
+		certificate staticCertificate
+		ready       bool
+	}{
+		{name: "no generation", status: jenkins.Status{}},
+		{name: "fresh", status: jenkins.Status{Current: fresh}, ready: true},
+		{name: "stale", status: jenkins.Status{Current: &jenkins.Generation{GenerationTimestamp: "2024-08-17T11:00:00Z"}}},
+		{name: "unparsable timestamp", status: jenkins.Status{Current: &jenkins.Generation{FetchedAt: now}}, ready: true},
+		{name: "failing refreshes", status: jenkins.Status{Current: fresh, ConsecutiveFailures: 3}},
+		{name: "few refresh failures", status: jenkins.Status{Current: fresh, ConsecutiveFailures: 2}, ready: true},
+		{name: "expired certificate", status: jenkins.Status{Current: fresh}, certificate: staticCertificate{Expired: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Server{
+				log: logger.Sugar(),
+				cfg: config.ServerConfig{Readiness: config.ReadinessConfig{
+					MaxFeedAge:              6 * time.Hour,
+					MaxRefreshFailures:      3,
+					RequireValidCertificate: true,
+				}},
+				updateCenter: &fakeUpdateCenter{status: tt.status},
+				certificates: tt.certificate,
+			}
+
+			if report := s.readiness(now); report.Ready != tt.ready {
+				t.Fatalf("ready is %t, expected %t: %+v", report.Ready, tt.ready, report.Checks)
+			}
+		})
+	}
+
+	s := Server{
+		log:          logger.Sugar(),
+		cfg:          config.ServerConfig{DownloadMode: config.DownloadModeRedirect, FeedTimeout: time.Second},
+		updateCenter: &fakeUpdateCenter{},
+	}
+
+	handlers, err := s.getHandlers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	handlers.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, readinessPath, nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("readiness without a generation returned %d", rec.Code)
+	}
+}
+
+// flakyProvider fails the original file checks while the upstream is down
+type flakyProvider struct {
+	sourcefileproviders.Provider
+	down *bool
+}
+
+func (p flakyProvider) GetMetadata(ctx context.Context) (sourcefileproviders.FileMetadata, error) {
+	if *p.down {
+		return sourcefileproviders.FileMetadata{}, errors.New("upstream is down")
+	}
+
+	return p.Provider.GetMetadata(ctx)
+}
+
+func TestReadinessRecovery(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	ctx := context.Background()
+
+	signerSvc, err := signer.NewSignerService(logger.Sugar(), config.SignerConfig{
+		CertificatePath: "../../testdata/certs/test.crt",
+		KeyPath:         "../../testdata/certs/test.key",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := localfile.NewLocalFileProvider("../../testdata/update-center/update-center.jsonp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	down := false
+
+	juc := jenkins.NewJenkinsUpdateCenter(logger.Sugar(), config.AppConfig{
+		DataDirPath:              t.TempDir(),
+		GetUpdateJSONBodyTimeout: 10 * time.Second,
+	}, flakyProvider{Provider: p, down: &down}, signerSvc, signerSvc, nil)
+
+	s := Server{
+		log: logger.Sugar(),
+		cfg: config.ServerConfig{
+			DownloadMode: config.DownloadModeRedirect,
+			FeedTimeout:  time.Second,
+			Readiness:    config.ReadinessConfig{MaxRefreshFailures: 2},
+		},
+		updateCenter: juc,
+	}
+
+	handlers, err := s.getHandlers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ready := func() int {
+		rec := httptest.NewRecorder()
+		handlers.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, readinessPath, nil))
+
+		return rec.Code
+	}
+
+	if err := juc.RefreshContent(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	down = true
+
+	for range 2 {
+		if err := juc.RefreshContent(ctx); err == nil {
+			t.Fatal("refresh succeeded with the upstream down")
+		}
+	}
+
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Fatalf("readiness during the outage returned %d", code)
+	}
+
+	// the upstream recovers with the same file
+	down = false
+
+	if err := juc.RefreshContent(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := ready(); code != http.StatusOK {
+		t.Fatalf("readiness after the outage returned %d", code)
+	}
+
+	if status := juc.Status(); status.LastError != nil {
+		t.Fatalf("refresh error %+v is kept after the recovery", status.LastError)
+	}
+}
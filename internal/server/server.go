@@ -2,38 +2,125 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"strconv"
 	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/auth"
 	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
 	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/mirror"
 )
 
+type MirrorAuditReporter interface {
+	LastReport() *mirror.Report
+}
+
+type MirrorPicker interface {
+	Pick(clientIP net.IP) (string, bool)
+}
+
 type Server struct {
 	log *zap.SugaredLogger
 
 	cfg config.ServerConfig
 
 	patchedFileProvider jenkins.PatchedFileRefresher
+	mirrorAuditor       MirrorAuditReporter
+	mirrorPicker        MirrorPicker
+	signAPI             http.Handler
+	trustAnchors        TrustAnchorProvider
+	updateCenter        UpdateCenterAdmin
+	certificates        CertificateInfoProvider
+	adminTokens         auth.Tokens
+	access              *accessControl
+	proxies             trustedProxies
+	profiles            []*mirrorProfile
 
 	dataDir    string
 	proxyToURL string
 
-	srv *http.Server
+	listens     []listenSpec
+	srv         *http.Server
+	redirectSrv *http.Server
+	adminSrv    *http.Server
+	reloaders   []*certificateReloader
+}
+
+// UpdateCenter serves, refreshes and reports the feed
+type UpdateCenter interface {
+	jenkins.PatchedFileRefresher
+	UpdateCenterAdmin
 }
 
-func NewServer(log *zap.SugaredLogger, cfg config.ServerConfig, jsonFileProvider jenkins.PatchedFileRefresher, dataDir, proxyToURL string) (Server, error) {
+// SigningCertificates describes the certificates the feed is signed with
+type SigningCertificates interface {
+	TrustAnchorProvider
+	CertificateInfoProvider
+}
+
+// Dependencies are the services the server is built on, the optional ones are nil when disabled
+type Dependencies struct {
+	UpdateCenter        UpdateCenter
+	SigningCertificates SigningCertificates
+	MirrorAuditor       MirrorAuditReporter
+	MirrorPicker        MirrorPicker
+	SignAPI             http.Handler
+
+	// DataDir holds the served files, ProxyToURL is the mirror the artifact downloads are proxied to
+	DataDir    string
+	ProxyToURL string
+}
+
+func NewServer(log *zap.SugaredLogger, cfg config.ServerConfig, deps Dependencies) (Server, error) {
 	s := Server{
 		log:                 log,
 		cfg:                 cfg,
-		patchedFileProvider: jsonFileProvider,
-		dataDir:             dataDir,
-		proxyToURL:          proxyToURL,
+		patchedFileProvider: deps.UpdateCenter,
+		mirrorAuditor:       deps.MirrorAuditor,
+		mirrorPicker:        deps.MirrorPicker,
+		signAPI:             deps.SignAPI,
+		trustAnchors:        deps.SigningCertificates,
+		updateCenter:        deps.UpdateCenter,
+		certificates:        deps.SigningCertificates,
+		dataDir:             deps.DataDir,
+		proxyToURL:          deps.ProxyToURL,
+	}
+
+	if cfg.Admin.TokensPath != "" {
+		tokens, err := auth.LoadTokens(cfg.Admin.TokensPath)
+		if err != nil {
+			return Server{}, fmt.Errorf("cannot load admin API tokens: %w", err)
+		}
+
+		log.Infof("admin API is enabled for %d callers", len(tokens))
+
+		s.adminTokens = tokens
+	}
+
+	access, err := newAccessControl(cfg.Access)
+	if err != nil {
+		return Server{}, fmt.Errorf("cannot initialize access control: %w", err)
+	}
+
+	s.access = access
+
+	if s.proxies, err = newTrustedProxies(cfg.Access.TrustedProxies); err != nil {
+		return Server{}, err
+	}
+
+	if s.profiles, err = newMirrorProfiles(cfg.MirrorProfiles); err != nil {
+		return Server{}, fmt.Errorf("invalid mirror profiles: %w", err)
+	}
+
+	if cfg.PublicURL == "" {
+		log.Warn("public URL is not set, the bootstrap files point controllers to the host the request names")
 	}
 
 	handlers, err := s.getHandlers()
@@ -41,45 +128,186 @@ func NewServer(log *zap.SugaredLogger, cfg config.ServerConfig, jsonFileProvider
 		return Server{}, fmt.Errorf("could not initialize handlers: %w", err)
 	}
 
+	tlsCfg, err := s.listenerTLSConfig(cfg.TLSCertPath, cfg.TLSKeyPath, true)
+	if err != nil {
+		return Server{}, err
+	}
+
+	if s.listens, err = s.parseListenSpecs(); err != nil {
+		return Server{}, fmt.Errorf("invalid listeners: %w", err)
+	}
+
 	s.srv = &http.Server{
-		Addr:              cfg.ListenAddr + ":" + strconv.Itoa(cfg.ListenPort),
 		Handler:           handlers,
+		TLSConfig:         tlsCfg,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	if cfg.RedirectToHTTPS {
+		port, ok := httpsPort(s.listens)
+		if !ok && httpsPublicURL(cfg.PublicURL) == "" {
+			return Server{}, fmt.Errorf("redirect to HTTPS requires a TCP HTTPS listener or an HTTPS public URL")
+		}
+
+		s.redirectSrv = &http.Server{
+			Handler:           s.getRedirectHandlers(port),
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+	}
+
+	if cfg.Admin.ListenPort == 0 {
+		log.Warn("admin listener is disabled, pprof, metrics, status and admin API are not served")
+
+		return s, nil
+	}
+
+	adminTLSCfg, err := s.listenerTLSConfig(cfg.Admin.TLSCertPath, cfg.Admin.TLSKeyPath, false)
+	if err != nil {
+		return Server{}, fmt.Errorf("admin listener: %w", err)
+	}
+
+	s.adminSrv = &http.Server{
+		Addr:              cfg.Admin.ListenAddr + ":" + strconv.Itoa(cfg.Admin.ListenPort),
+		Handler:           s.getAdminHandlers(),
+		TLSConfig:         adminTLSCfg,
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 
 	return s, nil
 }
 
+// listenerTLSConfig returns nil for the plain HTTP listeners
+func (s *Server) listenerTLSConfig(certPath, keyPath string, clientAuth bool) (*tls.Config, error) {
+	if certPath == "" || keyPath == "" {
+		return nil, nil
+	}
+
+	reloader, err := newCertificateReloader(s.log, certPath, keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsCfg, err := newTLSConfig(s.cfg, reloader, clientAuth)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS settings: %w", err)
+	}
+
+	s.reloaders = append(s.reloaders, reloader)
+
+	return tlsCfg, nil
+}
+
+// ListenAndServe serves the public and the admin listeners until the context is done or one of them fails
 func (s Server) ListenAndServe(ctx context.Context) error {
+	listeners, err := s.openListeners()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	servers := []*http.Server{s.srv}
+	for _, srv := range []*http.Server{s.redirectSrv, s.adminSrv} {
+		if srv != nil {
+			servers = append(servers, srv)
+		}
+	}
+
 	go func(ctx context.Context) {
 		<-ctx.Done()
 
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 		defer cancel()
 
-		if err := s.srv.Shutdown(shutdownCtx); err != nil {
-			s.log.Warnf("cannot gracefully shutdown http server: %v", err)
+		for _, srv := range servers {
+			if err := srv.Shutdown(shutdownCtx); err != nil {
+				s.log.Warnf("cannot gracefully shutdown http server: %v", err)
+			}
 		}
 	}(ctx)
 
-	if s.cfg.TLSCertPath != "" && s.cfg.TLSKeyPath != "" {
-		s.log.Infof("starting https server on %s:%d", s.cfg.ListenAddr, s.cfg.ListenPort)
+	for _, reloader := range s.reloaders {
+		go reloader.Run(ctx, s.cfg.TLSReloadCheckInterval)
+	}
 
-		if err := s.srv.ListenAndServeTLS(s.cfg.TLSCertPath, s.cfg.TLSKeyPath); err != nil {
-			if !errors.Is(err, http.ErrServerClosed) {
-				return err
-			}
-		}
-		return nil
+	pending := len(listeners)
+	if s.adminSrv != nil {
+		pending++
+	}
+
+	errs := make(chan error, pending)
+
+	for _, l := range listeners {
+		go func() {
+			errs <- s.serveListener(l)
+		}()
 	}
 
-	s.log.Infof("starting http server on %s:%d", s.cfg.ListenAddr, s.cfg.ListenPort)
+	if s.adminSrv != nil {
+		go func() {
+			errs <- s.serve(s.adminSrv, "admin ")
+		}()
+	}
+
+	var firstErr error
+
+	for range pending {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
 
-	if err := s.srv.ListenAndServe(); err != nil {
-		if !errors.Is(err, http.ErrServerClosed) {
-			return err
+			// the other listeners are not left running alone
+			cancel()
 		}
 	}
 
+	return firstErr
+}
+
+func (s Server) serve(srv *http.Server, kind string) error {
+	var err error
+
+	if srv.TLSConfig != nil {
+		s.log.Infof("starting %shttps server on %s", kind, srv.Addr)
+
+		// the certificate is provided by the reloader
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		s.log.Infof("starting %shttp server on %s", kind, srv.Addr)
+
+		err = srv.ListenAndServe()
+	}
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%sserver on %s: %w", kind, srv.Addr, err)
+	}
+
+	return nil
+}
+
+// serveListener serves the public handlers, or the redirect to HTTPS on the plain listeners when it is enabled
+func (s Server) serveListener(l boundListener) error {
+	var err error
+
+	switch {
+	case l.tls:
+		s.log.Infof("starting https server on %s", l.spec)
+
+		err = s.srv.ServeTLS(l, "", "")
+	// the unix and systemd sockets are reached through local reverse proxies, which would follow the redirect back
+	case s.redirectSrv != nil && l.network == "tcp":
+		s.log.Infof("starting http server redirecting to https on %s", l.spec)
+
+		err = s.redirectSrv.Serve(l)
+	default:
+		s.log.Infof("starting http server on %s", l.spec)
+
+		err = s.srv.Serve(l)
+	}
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("server on %s: %w", l.spec, err)
+	}
+
 	return nil
 }
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// certificateReloader serves the certificate and key read from the files and reloads them when they change
+type certificateReloader struct {
+	log *zap.SugaredLogger
+
+	certPath, keyPath string
+
+	mu    sync.RWMutex
+	cert  *tls.Certificate
+	state string
+}
+
+func newCertificateReloader(log *zap.SugaredLogger, certPath, keyPath string) (*certificateReloader, error) {
+	c := &certificateReloader{
+		log:      log,
+		certPath: certPath,
+		keyPath:  keyPath,
+	}
+
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// filesState returns the modification times and sizes of the files to detect the changes
+func (c *certificateReloader) filesState() string {
+	var state string
+
+	for _, path := range []string{c.certPath, c.keyPath} {
+		fi, err := os.Stat(path)
+		if err != nil {
+			state += fmt.Sprintf("%s:%v;", path, err)
+			continue
+		}
+
+		state += fmt.Sprintf("%s:%d:%d;", path, fi.ModTime().UnixNano(), fi.Size())
+	}
+
+	return state
+}
+
+func (c *certificateReloader) reload() error {
+	state := c.filesState()
+
+	cert, err := tls.LoadX509KeyPair(c.certPath, c.keyPath)
+	if err != nil {
+		return fmt.Errorf("cannot load TLS certificate: %w", err)
+	}
+
+	c.mu.Lock()
+	c.cert, c.state = &cert, state
+	c.mu.Unlock()
+
+	if cert.Leaf != nil {
+		c.log.Infof("TLS certificate %q valid until %s loaded from %s", cert.Leaf.Subject, cert.Leaf.NotAfter, c.certPath)
+	}
+
+	return nil
+}
+
+func (c *certificateReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cert, nil
+}
+
+// Run reloads the certificate whenever the files change, the current one is kept when the new one cannot be loaded
+func (c *certificateReloader) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.mu.RLock()
+			state := c.state
+			c.mu.RUnlock()
+
+			if c.filesState() == state {
+				continue
+			}
+
+			c.log.Infof("TLS certificate files changed, reloading")
+
+			if err := c.reload(); err != nil {
+				c.log.Errorf("keeping the current TLS certificate: %v", err)
+
+				// the files are not retried until they change again
+				c.mu.Lock()
+				c.state = c.filesState()
+				c.mu.Unlock()
+			}
+		}
+	}
+}
+
+func cipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("cipher suite %q is unknown or insecure", name)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func loadClientCAs(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("cannot read client CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in client CA bundle %s", path)
+	}
+
+	return pool, nil
+}
+
+// newTLSConfig applies the TLS policy, the client certificates are verified on the public listener only
+func newTLSConfig(cfg config.ServerConfig, reloader *certificateReloader, clientAuth bool) (*tls.Config, error) {
+	suites, err := cipherSuites(cfg.TLSCipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsCfg := &tls.Config{
+		MinVersion:     tlsVersions[cfg.TLSMinVersion],
+		CipherSuites:   suites,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if !clientAuth || cfg.TLSClientAuth == config.TLSClientAuthNone || cfg.TLSClientAuth == "" {
+		return tlsCfg, nil
+	}
+
+	if tlsCfg.ClientCAs, err = loadClientCAs(cfg.TLSClientCAPath); err != nil {
+		return nil, err
+	}
+
+	tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+	if cfg.TLSClientAuth == config.TLSClientAuthRequire {
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsCfg, nil
+}
+
+func verifiedClientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// clientCertificateName identifies the client by its verified certificate
+func clientCertificateName(r *http.Request) (string, bool) {
+	cert := verifiedClientCertificate(r)
+	if cert == nil {
+		return "", false
+	}
+
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName, true
+	}
+
+	return cert.Subject.String(), true
+}
+
+// clientCertificateNames are the common name and the DNS, email and URI SANs of the certificate
+func clientCertificateNames(cert *x509.Certificate) []string {
+	names := make([]string, 0, 1+len(cert.DNSNames)+len(cert.EmailAddresses)+len(cert.URIs))
+
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+
+	for _, u := range cert.URIs {
+		names = append(names, u.String())
+	}
+
+	return names
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+)
+
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func issue(t *testing.T, cn string, parent *testCertificate, usage x509.ExtKeyUsage) *testCertificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+
+	signer := &testCertificate{cert: template, key: key}
+
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		signer = parent
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer.cert, &key.PublicKey, signer.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCertificate{cert: cert, key: key}
+}
+
+func (c *testCertificate) write(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPath, keyPath := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certPath, keyPath
+}
+
+func TestTLS(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	log := logger.Sugar()
+
+	dir := t.TempDir()
+
+	ca := issue(t, "test CA", nil, x509.ExtKeyUsageAny)
+	caPath, _ := ca.write(t, dir, "ca")
+
+	certPath, keyPath := issue(t, "first", ca, x509.ExtKeyUsageServerAuth).write(t, dir, "server")
+
+	reloader, err := newCertificateReloader(log, certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.ServerConfig{
+		TLSMinVersion:   "1.2",
+		TLSCipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+		TLSClientCAPath: caPath,
+		TLSClientAuth:   config.TLSClientAuthOptional,
+		DownloadMode:    config.DownloadModeRedirect,
+		FeedTimeout:     time.Second,
+	}
+
+	tlsCfg, err := newTLSConfig(cfg, reloader, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newTLSConfig(config.ServerConfig{TLSCipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}, reloader, false); err == nil {
+		t.Fatal("insecure cipher suite accepted")
+	}
+
+	s := Server{
+		log:          log,
+		cfg:          cfg,
+		mirrorPicker: staticMirror("https://mirror.local"),
+		access:       &accessControl{},
+	}
+
+	handlers, err := s.getHandlers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// StartTLS would put its own certificate in front of the reloader
+	srv := httptest.NewUnstartedServer(handlers)
+	srv.Listener = tls.NewListener(srv.Listener, tlsCfg)
+	srv.Start()
+	defer srv.Close()
+
+	serverURL := strings.Replace(srv.URL, "http://", "https://", 1)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	client := issue(t, "controller-1", ca, x509.ExtKeyUsageClientAuth)
+
+	get := func(clientCerts []tls.Certificate) (int, string) {
+		c := &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: clientCerts}},
+			CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+
+		resp, err := c.Get(serverURL + "/plugins/a.hpi")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		return resp.StatusCode, resp.TLS.PeerCertificates[0].Subject.CommonName
+	}
+
+	clientCert := []tls.Certificate{{Certificate: [][]byte{client.cert.Raw}, PrivateKey: client.key}}
+
+	if status, _ := get(nil); status != http.StatusForbidden {
+		t.Fatalf("request without client certificate returned %d", status)
+	}
+
+	if status, serverCN := get(clientCert); status != http.StatusFound || serverCN != "first" {
+		t.Fatalf("request with client certificate returned %d from %s", status, serverCN)
+	}
+
+	s.access.certs = map[string]bool{"controller-2": true}
+
+	if status, _ := get(clientCert); status != http.StatusForbidden {
+		t.Fatalf("request with a client certificate not allowed returned %d", status)
+	}
+
+	allowed := issue(t, "controller-2", ca, x509.ExtKeyUsageClientAuth)
+
+	if status, _ := get([]tls.Certificate{{Certificate: [][]byte{allowed.cert.Raw}, PrivateKey: allowed.key}}); status != http.StatusFound {
+		t.Fatalf("request with an allowed client certificate returned %d", status)
+	}
+
+	s.access.certs = nil
+
+	// renewed certificate is picked up without a restart
+	issue(t, "second", ca, x509.ExtKeyUsageServerAuth).write(t, dir, "server")
+
+	go reloader.Run(t.Context(), 10*time.Millisecond)
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		if _, serverCN := get(clientCert); serverCN == "second" {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("renewed certificate is not served")
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	_ http.RoundTripper = idleTimeoutTransport{}
+)
+
+// idleTimeoutTransport cancels the upstream request when neither headers nor body data arrive within the timeout,
+// so large artifacts are never cut off by a total deadline while stalled transfers are still aborted. Only the waits
+// for the upstream count, the time spent writing to a slow client does not. A zero timeout disables it.
+type idleTimeoutTransport struct {
+	rt      http.RoundTripper
+	timeout time.Duration
+}
+
+func (t idleTimeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.timeout <= 0 {
+		return t.rt.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(t.timeout, cancel)
+
+	resp, err := t.rt.RoundTrip(req.WithContext(ctx))
+
+	timer.Stop()
+
+	if err != nil {
+		cancel()
+
+		return nil, err
+	}
+
+	resp.Body = &idleTimeoutBody{
+		ReadCloser: resp.Body,
+		timer:      timer,
+		timeout:    t.timeout,
+		cancel:     cancel,
+	}
+
+	return resp, nil
+}
+
+type idleTimeoutBody struct {
+	io.ReadCloser
+
+	timer   *time.Timer
+	timeout time.Duration
+
+	once   sync.Once
+	cancel context.CancelFunc
+}
+
+// Read runs the timer while the upstream is awaited only
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	b.timer.Reset(b.timeout)
+	defer b.timer.Stop()
+
+	return b.ReadCloser.Read(p)
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.once.Do(func() {
+		b.timer.Stop()
+		b.cancel()
+	})
+
+	return b.ReadCloser.Close()
+}
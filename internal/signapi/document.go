@@ -0,0 +1,141 @@
+package signapi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"olympos.io/encoding/cjson"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/types"
+)
+
+const signatureField = "signature"
+
+// Document is a JSON object without its signature in the canonical form signatures are computed over
+type Document []byte
+
+// Canonicalize reads a JSON object, drops its signature if any and returns the canonical form of the rest
+func Canonicalize(r io.Reader) (Document, error) {
+	dec := json.NewDecoder(r)
+
+	var fields map[string]json.RawMessage
+	if err := dec.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("document is not a JSON object: %w", err)
+	}
+
+	if dec.More() {
+		return nil, fmt.Errorf("document has trailing data")
+	}
+
+	delete(fields, signatureField)
+
+	for name, value := range fields {
+		if err := checkNumbers(value); err != nil {
+			return nil, fmt.Errorf("field %q: %w", name, err)
+		}
+	}
+
+	return canonicalize(fields)
+}
+
+// checkNumbers refuses the numbers the canonical form would change, it keeps the integers below 10^15 written
+// without a fraction or an exponent only
+func checkNumbers(value json.RawMessage) error {
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.UseNumber()
+
+	for {
+		token, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		number, ok := token.(json.Number)
+		if !ok {
+			continue
+		}
+
+		var buf bytes.Buffer
+		if _, err := cjson.Canonicalize(&buf, strings.NewReader(number.String())); err != nil {
+			return fmt.Errorf("cannot canonicalize number %s: %w", number, err)
+		}
+
+		if buf.String() != number.String() {
+			return fmt.Errorf("number %s would be signed as %s, pass it as a string or an integer below 10^15", number, buf.String())
+		}
+	}
+}
+
+func canonicalize(fields map[string]json.RawMessage) (Document, error) {
+	bytez, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal document: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := cjson.Canonicalize(&buf, bytes.NewReader(bytez)); err != nil {
+		return nil, fmt.Errorf("cannot canonicalize document: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (d Document) MarshalJSON() ([]byte, error) {
+	return d, nil
+}
+
+// Digest returns the hex encoded SHA-256 of the canonical document
+func (d Document) Digest() string {
+	sum := sha256.Sum256(d)
+	return hex.EncodeToString(sum[:])
+}
+
+type documentHeader struct {
+	ID                  string `json:"id"`
+	GenerationTimestamp string `json:"generationTimestamp"`
+}
+
+func (d Document) header() documentHeader {
+	var header documentHeader
+
+	_ = json.Unmarshal(d, &header)
+
+	return header
+}
+
+// ID returns the id field of update center like documents
+func (d Document) ID() string {
+	return d.header().ID
+}
+
+// GenerationTimestamp returns the generationTimestamp field of update center like documents
+func (d Document) GenerationTimestamp() string {
+	return d.header().GenerationTimestamp
+}
+
+// WithSignature returns the canonical document with the signature attached
+func (d Document) WithSignature(signature types.Signature) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(d, &fields); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal document: %w", err)
+	}
+
+	bytez, err := json.Marshal(signature)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal signature: %w", err)
+	}
+
+	fields[signatureField] = bytez
+
+	return canonicalize(fields)
+}
@@ -0,0 +1,110 @@
+package signapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/auth"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/types"
+)
+
+var (
+	_ http.Handler = (*Service)(nil)
+)
+
+// Service signs arbitrary Jenkins-style JSON documents for the authenticated callers, every request is audit-logged
+type Service struct {
+	log    *zap.SugaredLogger
+	cfg    config.SignAPIConfig
+	signer types.Signer
+
+	callers auth.Tokens
+}
+
+func NewService(log *zap.SugaredLogger, cfg config.SignAPIConfig, signer types.Signer) (*Service, error) {
+	callers, err := auth.LoadTokens(cfg.TokensPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load signing API tokens: %w", err)
+	}
+
+	log.Infof("signing API is enabled for %d callers", len(callers))
+
+	return &Service{
+		log:     log,
+		cfg:     cfg,
+		signer:  signer,
+		callers: callers,
+	}, nil
+}
+
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	caller, ok := s.callers.Authenticate(r)
+	if !ok {
+		s.log.Warnw("signing request rejected", "remoteAddr", r.RemoteAddr, "reason", "unauthenticated")
+
+		w.Header().Set("WWW-Authenticate", `Bearer realm="sign"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+
+		return
+	}
+
+	doc, err := Canonicalize(http.MaxBytesReader(w, r.Body, s.cfg.MaxDocumentSize))
+	if err != nil {
+		s.log.Warnw("signing request rejected", "caller", caller, "remoteAddr", r.RemoteAddr, "reason", err.Error())
+
+		status := http.StatusBadRequest
+
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+
+		http.Error(w, err.Error(), status)
+
+		return
+	}
+
+	signed, err := s.sign(types.WithSigningDetails(r.Context(), types.SigningDetails{
+		Source:              "sign-api",
+		Caller:              caller,
+		GenerationTimestamp: doc.GenerationTimestamp(),
+	}), doc)
+	if err != nil {
+		s.log.Errorw("document signing failed", "caller", caller, "remoteAddr", r.RemoteAddr, "sha256", doc.Digest(), "error", err)
+		http.Error(w, "cannot sign document", http.StatusInternalServerError)
+
+		return
+	}
+
+	s.log.Infow("document signed",
+		"caller", caller,
+		"remoteAddr", r.RemoteAddr,
+		"id", doc.ID(),
+		"size", len(doc),
+		"sha256", doc.Digest(),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, err := w.Write(signed); err != nil {
+		s.log.Warnf("cannot write signed document: %v", err)
+	}
+}
+
+func (s *Service) sign(ctx context.Context, doc Document) ([]byte, error) {
+	signature, err := s.signer.GetSignature(ctx, doc)
+	if err != nil {
+		return nil, fmt.Errorf("cannot calculate signature: %w", err)
+	}
+
+	if err := s.signer.VerifySignature(doc, signature); err != nil {
+		return nil, fmt.Errorf("cannot verify signature: %w", err)
+	}
+
+	return doc.WithSignature(signature)
+}
@@ -0,0 +1,118 @@
+package signapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/signer"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/types"
+)
+
+func TestCanonicalize(t *testing.T) {
+	doc, err := Canonicalize(strings.NewReader(`{"b": [1, -2, {"c": 999999999999999}], "a": "x", "signature": {"correct_digest": "bogus"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := `{"a":"x","b":[1,-2,{"c":999999999999999}]}`; string(doc) != expected {
+		t.Fatalf("unexpected canonical form %s, expected %s", doc, expected)
+	}
+
+	for _, invalid := range []string{`[1, 2]`, `{"a": 1} {"b": 2}`, `{"a":`} {
+		if _, err := Canonicalize(strings.NewReader(invalid)); err == nil {
+			t.Fatalf("invalid document %q accepted", invalid)
+		}
+	}
+
+	// the canonical form would change these values
+	for _, changed := range []string{`{"a": 1.50}`, `{"c": [1e3]}`, `{"c": [12345678901234567890]}`, `{"d": {"e": -0}}`, `{"a": 1.0}`} {
+		if _, err := Canonicalize(strings.NewReader(changed)); err == nil || !strings.Contains(err.Error(), "would be signed as") {
+			t.Fatalf("document %s with a changed number accepted: %v", changed, err)
+		}
+	}
+}
+
+func TestSignAPI(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	log := logger.Sugar()
+
+	signerSvc, err := signer.NewSignerService(log, config.SignerConfig{
+		CertificatePath: "../../testdata/certs/test.crt",
+		KeyPath:         "../../testdata/certs/test.key",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokensPath := filepath.Join(t.TempDir(), "tokens")
+	if err := os.WriteFile(tokensPath, []byte("# team tokens\ntools-team: s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	api, err := NewService(log, config.SignAPIConfig{TokensPath: tokensPath, MaxDocumentSize: 1024}, signerSvc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/sign", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+
+		return w
+	}
+
+	const doc = `{"list": [{"id": "maven", "name": "Maven"}], "id": "hudson.tasks.Maven.MavenInstallation"}`
+
+	for name, test := range map[string]struct {
+		token, body string
+		statusCode  int
+	}{
+		"anonymous":   {body: doc, statusCode: http.StatusUnauthorized},
+		"wrong-token": {token: "guess", body: doc, statusCode: http.StatusUnauthorized},
+		"not-json":    {token: "s3cret", body: "downloadService.post()", statusCode: http.StatusBadRequest},
+		"float":       {token: "s3cret", body: `{"a": 1.50, "c": [1e3, 12345678901234567890]}`, statusCode: http.StatusBadRequest},
+		"too-large":   {token: "s3cret", body: `{"a": "` + strings.Repeat("x", 1024) + `"}`, statusCode: http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if w := request(test.token, test.body); w.Code != test.statusCode {
+				t.Fatalf("unexpected status code %d", w.Code)
+			}
+		})
+	}
+
+	w := request("s3cret", doc)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", w.Code, w.Body)
+	}
+
+	var signed struct {
+		Signature types.Signature `json:"signature"`
+	}
+
+	if err := json.Unmarshal(w.Body.Bytes(), &signed); err != nil {
+		t.Fatal(err)
+	}
+
+	unsigned, err := Canonicalize(bytes.NewReader(w.Body.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := signerSvc.VerifySignature(unsigned, signed.Signature); err != nil {
+		t.Fatalf("signed document is not verified: %v", err)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package signinglog
+
+import "os"
+
+// lock is a no-op where flock is not available, a single process must append to the log there
+func lock(_ *os.File) error {
+	return nil
+}
+
+func unlock(_ *os.File) error {
+	return nil
+}
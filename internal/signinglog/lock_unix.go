@@ -0,0 +1,22 @@
+//go:build unix
+
+package signinglog
+
+import (
+	"os"
+	"syscall"
+)
+
+// lock takes the exclusive advisory lock of the log, the other processes appending to it wait for it
+func lock(f *os.File) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+func unlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
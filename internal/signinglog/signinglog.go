@@ -0,0 +1,315 @@
+// Package signinglog keeps an append-only log of the signatures where every entry is chained to the previous one
+// by its hash, so removing or altering any entry breaks the chain
+package signinglog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"olympos.io/encoding/cjson"
+)
+
+const maxEntrySize = 1 << 20
+
+type Entry struct {
+	Seq                    uint64    `json:"seq"`
+	Time                   time.Time `json:"time"`
+	Source                 string    `json:"source,omitempty"`
+	Caller                 string    `json:"caller,omitempty"`
+	DocumentSHA512         string    `json:"documentSha512"`
+	DocumentSHA1           string    `json:"documentSha1"`
+	GenerationTimestamp    string    `json:"generationTimestamp,omitempty"`
+	Patchers               []string  `json:"patchers,omitempty"`
+	CertificateFingerprint string    `json:"certificateFingerprint"`
+	Signature512           string    `json:"signature512"`
+	PrevHash               string    `json:"prevHash"`
+	Hash                   string    `json:"hash"`
+}
+
+// computeHash returns the SHA-256 of the canonical entry without its own hash
+func (e Entry) computeHash() (string, error) {
+	e.Hash = ""
+
+	bytez, err := cjson.Marshal(e)
+	if err != nil {
+		return "", fmt.Errorf("cannot marshal entry: %w", err)
+	}
+
+	sum := sha256.Sum256(bytez)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Log appends to the file under an exclusive lock and chains every entry to the last one in the file, so the
+// server and the sign command can share the log
+type Log struct {
+	mu   sync.Mutex
+	f    *os.File
+	last Entry
+}
+
+// Open verifies the existing log and opens it for appending, the log is created if it does not exist. An incomplete
+// last entry left by an interrupted append is truncated, any other broken entry fails the verification
+func Open(log *zap.SugaredLogger, path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("cannot open signing log: %w", err)
+	}
+
+	l := &Log{f: f}
+
+	if err := l.locked(func() error {
+		dropped, err := truncateIncompleteEntry(f)
+		if err != nil {
+			return fmt.Errorf("cannot repair signing log %s: %w", path, err)
+		}
+
+		if dropped > 0 {
+			log.Warnf("signing log %s ends with an incomplete entry of %d bytes left by an interrupted write, it is truncated", path, dropped)
+		}
+
+		if _, l.last, err = Verify(io.NewSectionReader(f, 0, math.MaxInt64)); err != nil {
+			return fmt.Errorf("signing log %s is broken: %w", path, err)
+		}
+
+		return nil
+	}); err != nil {
+		_ = f.Close()
+
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// locked runs fn holding the file lock, which keeps the other processes from writing meanwhile
+func (l *Log) locked(fn func() error) error {
+	if err := lock(l.f); err != nil {
+		return fmt.Errorf("cannot lock signing log: %w", err)
+	}
+
+	err := fn()
+
+	if unlockErr := unlock(l.f); unlockErr != nil && err == nil {
+		err = fmt.Errorf("cannot unlock signing log: %w", unlockErr)
+	}
+
+	return err
+}
+
+// readTail returns the end of the log the last entry starts within, an entry never exceeds maxEntrySize
+func readTail(f *os.File) ([]byte, int64, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset := max(fi.Size()-maxEntrySize-2, 0)
+
+	tail := make([]byte, fi.Size()-offset)
+	if _, err := f.ReadAt(tail, offset); err != nil {
+		return nil, 0, err
+	}
+
+	return tail, offset, nil
+}
+
+// truncateIncompleteEntry cuts the log after its last newline and returns the number of bytes dropped, it must be
+// called holding the lock, so the partial entry cannot be one another process is writing
+func truncateIncompleteEntry(f *os.File) (int64, error) {
+	tail, offset, err := readTail(f)
+	if err != nil {
+		return 0, err
+	}
+
+	size := offset + int64(len(tail))
+
+	complete := offset + int64(bytes.LastIndexByte(tail, '\n')+1)
+	if complete == size || (complete == offset && offset > 0) {
+		// the log is complete or the incomplete entry is too long to be a partial write, the verification reports it
+		return 0, nil
+	}
+
+	if err := f.Truncate(complete); err != nil {
+		return 0, err
+	}
+
+	return size - complete, f.Sync()
+}
+
+// head returns the last entry of the file, which another process may have appended since the previous call
+func (l *Log) head() (Entry, error) {
+	if _, err := truncateIncompleteEntry(l.f); err != nil {
+		return Entry{}, fmt.Errorf("cannot repair signing log: %w", err)
+	}
+
+	tail, _, err := readTail(l.f)
+	if err != nil {
+		return Entry{}, fmt.Errorf("cannot read signing log: %w", err)
+	}
+
+	tail = bytes.TrimSuffix(tail, []byte{'\n'})
+	if len(tail) == 0 {
+		if l.last.Seq > 0 {
+			return Entry{}, fmt.Errorf("signing log has been emptied after entry %d", l.last.Seq)
+		}
+
+		return Entry{}, nil
+	}
+
+	var last Entry
+	if err := json.Unmarshal(tail[bytes.LastIndexByte(tail, '\n')+1:], &last); err != nil {
+		return Entry{}, fmt.Errorf("cannot parse the last entry: %w", err)
+	}
+
+	if hash, err := last.computeHash(); err != nil || hash != last.Hash {
+		return Entry{}, fmt.Errorf("the last entry %d has been altered", last.Seq)
+	}
+
+	if last.Seq < l.last.Seq {
+		return Entry{}, fmt.Errorf("signing log has been cut to entry %d after entry %d", last.Seq, l.last.Seq)
+	}
+
+	return last, nil
+}
+
+// Append chains the entry to the last one in the file and syncs it to disk before returning
+func (l *Log) Append(e Entry) (Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	err := l.locked(func() error {
+		last, err := l.head()
+		if err != nil {
+			return err
+		}
+
+		e.Seq = last.Seq + 1
+		e.PrevHash = last.Hash
+
+		if e.Time.IsZero() {
+			e.Time = time.Now().UTC()
+		}
+
+		if e.Hash, err = e.computeHash(); err != nil {
+			return err
+		}
+
+		line, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("cannot marshal entry: %w", err)
+		}
+
+		if _, err := l.f.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("cannot write entry: %w", err)
+		}
+
+		if err := l.f.Sync(); err != nil {
+			return fmt.Errorf("cannot sync signing log: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return Entry{}, err
+	}
+
+	l.last = e
+
+	return e, nil
+}
+
+func (l *Log) Close() error {
+	return l.f.Close()
+}
+
+// scan calls fn for every entry of the log in order
+func scan(r io.Reader, fn func(line int, e Entry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxEntrySize)
+
+	for line := 1; scanner.Scan(); line++ {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("line %d: cannot parse entry: %w", line, err)
+		}
+
+		if err := fn(line, e); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Verify checks every entry hash and the chain links, it returns the number of entries and the last one
+func Verify(r io.Reader) (int, Entry, error) {
+	var (
+		count int
+		last  Entry
+	)
+
+	err := scan(r, func(line int, e Entry) error {
+		if e.Seq != last.Seq+1 {
+			return fmt.Errorf("line %d: entry %d follows entry %d", line, e.Seq, last.Seq)
+		}
+
+		if e.PrevHash != last.Hash {
+			return fmt.Errorf("line %d: entry %d is not chained to the previous entry", line, e.Seq)
+		}
+
+		hash, err := e.computeHash()
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if hash != e.Hash {
+			return fmt.Errorf("line %d: entry %d has been altered", line, e.Seq)
+		}
+
+		count, last = count+1, e
+
+		return nil
+	})
+
+	return count, last, err
+}
+
+// normalizeDigest converts base64 encoded digests to the hex form the log keeps
+func normalizeDigest(digest string) string {
+	if raw, err := base64.StdEncoding.DecodeString(digest); err == nil && (len(raw) == 64 || len(raw) == 20) {
+		return hex.EncodeToString(raw)
+	}
+
+	return strings.ToLower(digest)
+}
+
+// Lookup returns the entries of the documents with the SHA-512 or SHA-1 digest, hex or base64 encoded
+func Lookup(r io.Reader, digest string) ([]Entry, error) {
+	var (
+		entries []Entry
+		needle  = normalizeDigest(digest)
+	)
+
+	err := scan(r, func(_ int, e Entry) error {
+		if e.DocumentSHA512 == needle || e.DocumentSHA1 == needle {
+			entries = append(entries, e)
+		}
+
+		return nil
+	})
+
+	return entries, err
+}
@@ -0,0 +1,192 @@
+package signinglog
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signing.log")
+
+	digests := []string{strings.Repeat("aa", 64), strings.Repeat("bb", 64), strings.Repeat("cc", 64)}
+
+	for i, digest := range digests {
+		// reopening continues the chain
+		l, err := Open(zap.NewNop().Sugar(), path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		e, err := l.Append(Entry{DocumentSHA512: digest, Source: "refresh"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if e.Seq != uint64(i+1) {
+			t.Fatalf("unexpected sequence number %d", e.Seq)
+		}
+
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count, _, err := Verify(bytes.NewReader(data)); err != nil || count != 3 {
+		t.Fatalf("intact log is not verified: %d entries, %v", count, err)
+	}
+
+	lines := strings.SplitAfter(strings.TrimSuffix(string(data), "\n"), "\n")
+
+	for name, tampered := range map[string]string{
+		"altered": strings.Replace(string(data), `"source":"refresh"`, `"source":"sign-api"`, 1),
+		"removed": lines[0] + lines[2],
+		"reorder": lines[1] + lines[0] + lines[2],
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := Verify(strings.NewReader(tampered)); err == nil {
+				t.Fatal("tampered log is verified")
+			} else {
+				t.Logf("tampering detected: %v", err)
+			}
+		})
+	}
+
+	raw, _ := hex.DecodeString(digests[1])
+
+	for _, digest := range []string{digests[1], strings.ToUpper(digests[1]), base64.StdEncoding.EncodeToString(raw)} {
+		entries, err := Lookup(bytes.NewReader(data), digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(entries) != 1 || entries[0].Seq != 2 {
+			t.Fatalf("unexpected entries found by %s: %+v", digest, entries)
+		}
+	}
+}
+
+func TestIncompleteEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signing.log")
+	log := zap.NewNop().Sugar()
+
+	l, err := Open(log, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, digest := range []string{strings.Repeat("aa", 64), strings.Repeat("bb", 64)} {
+		if _, err := l.Append(Entry{DocumentSHA512: digest}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_ = l.Close()
+
+	intact, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.SplitAfter(strings.TrimSuffix(string(intact), "\n"), "\n")
+
+	// the append of the second entry is interrupted
+	if err := os.WriteFile(path, []byte(lines[0]+lines[1][:40]), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if l, err = Open(log, path); err != nil {
+		t.Fatalf("incomplete entry is not truncated: %v", err)
+	}
+
+	e, err := l.Append(Entry{DocumentSHA512: strings.Repeat("cc", 64)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = l.Close()
+
+	if e.Seq != 2 {
+		t.Fatalf("entry %d appended after the truncated one", e.Seq)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count, _, err := Verify(bytes.NewReader(data)); err != nil || count != 2 {
+		t.Fatalf("repaired log is not verified: %d entries, %v", count, err)
+	}
+
+	// a complete but broken entry is not dropped
+	broken := strings.Replace(string(intact), `"seq":2`, `"seq":3`, 1)
+	if err := os.WriteFile(path, []byte(broken), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(log, path); err == nil {
+		t.Fatal("broken chain is accepted")
+	}
+
+	if data, _ := os.ReadFile(path); string(data) != broken {
+		t.Fatal("broken log is modified")
+	}
+}
+
+func TestSharedLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signing.log")
+
+	// the server and the sign command open the same log
+	logs := make([]*Log, 2)
+
+	for i := range logs {
+		l, err := Open(zap.NewNop().Sugar(), path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+
+		logs[i] = l
+	}
+
+	var wg sync.WaitGroup
+
+	for _, l := range logs {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < 20; i++ {
+				if _, err := l.Append(Entry{DocumentSHA512: strings.Repeat("aa", 64)}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count, _, err := Verify(bytes.NewReader(data)); err != nil || count != 40 {
+		t.Fatalf("shared log forked: %d entries, %v", count, err)
+	}
+}
@@ -0,0 +1,215 @@
+// Package verifier checks update site files the way Jenkins does before trusting them
+package verifier
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/signer"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/types"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/signapi"
+)
+
+const (
+	FormatJSON  = "JSON"
+	FormatJSONP = "JSONP"
+	FormatHTML  = "HTML"
+)
+
+var (
+	errNotPresent = errors.New("not present")
+
+	htmlPrefix = []byte("JSON.stringify(")
+	htmlSuffix = []byte("),'*')")
+)
+
+// Step is the outcome of one of the checks, Skipped steps are neither passed nor failed
+type Step struct {
+	Name    string
+	Detail  string
+	Skipped bool
+	Err     error
+}
+
+type Report struct {
+	Steps []Step
+}
+
+// OK reports whether every step that was run has passed
+func (r *Report) OK() bool {
+	for _, step := range r.Steps {
+		if step.Err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *Report) add(name, detail string, err error) bool {
+	r.Steps = append(r.Steps, Step{Name: name, Detail: detail, Err: err})
+
+	return err == nil
+}
+
+func (r *Report) skip(name, detail string) {
+	r.Steps = append(r.Steps, Step{Name: name, Detail: detail, Skipped: true})
+}
+
+// unwrap extracts the JSON object from the JSONP or HTML wrapper the way Jenkins DownloadService does
+func unwrap(data []byte) (string, []byte, error) {
+	data = bytes.TrimSpace(data)
+
+	switch {
+	case bytes.HasPrefix(data, []byte("{")):
+		return FormatJSON, data, nil
+	case bytes.HasPrefix(data, []byte("<")):
+		start, end := bytes.Index(data, htmlPrefix), bytes.LastIndex(data, htmlSuffix)
+		if start < 0 || end < start {
+			return FormatHTML, nil, fmt.Errorf("postMessage(JSON.stringify(...)) call not found")
+		}
+
+		return FormatHTML, data[start+len(htmlPrefix) : end], nil
+	default:
+		start, end := bytes.IndexByte(data, '('), bytes.LastIndexByte(data, ')')
+		if start < 0 || end < start {
+			return FormatJSONP, nil, fmt.Errorf("neither JSON object nor JSONP call found")
+		}
+
+		return FormatJSONP, data[start+1 : end], nil
+	}
+}
+
+// digestMatches accepts hex and base64 encoded digests ignoring case, as Jenkins does
+func digestMatches(computed []byte, provided string) bool {
+	return strings.EqualFold(provided, hex.EncodeToString(computed)) ||
+		strings.EqualFold(provided, base64.StdEncoding.EncodeToString(computed))
+}
+
+// verifySignature tries the hex and then the base64 decoding of the provided signature, as Jenkins does
+func verifySignature(pub *rsa.PublicKey, hash crypto.Hash, digest []byte, provided string) error {
+	var decoded [][]byte
+
+	if sig, err := hex.DecodeString(provided); err == nil {
+		decoded = append(decoded, sig)
+	}
+
+	if sig, err := base64.StdEncoding.DecodeString(provided); err == nil {
+		decoded = append(decoded, sig)
+	}
+
+	if len(decoded) == 0 {
+		return fmt.Errorf("signature is neither hex nor base64 encoded")
+	}
+
+	var err error
+
+	for _, sig := range decoded {
+		if err = rsa.VerifyPKCS1v15(pub, hash, digest, sig); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+func (r *Report) checkDigest(name string, pub *rsa.PublicKey, hash crypto.Hash, computed []byte, providedDigest, providedSignature string) bool {
+	if providedDigest == "" {
+		r.skip(name+" digest", errNotPresent.Error())
+		r.skip(name+" signature", errNotPresent.Error())
+
+		return false
+	}
+
+	var err error
+	if !digestMatches(computed, providedDigest) {
+		err = fmt.Errorf("computed %s, provided %s", hex.EncodeToString(computed), providedDigest)
+	}
+
+	if !r.add(name+" digest", hex.EncodeToString(computed), err) {
+		return true
+	}
+
+	if providedSignature == "" {
+		r.add(name+" signature", "", errNotPresent)
+		return true
+	}
+
+	r.add(name+" signature", "", verifySignature(pub, hash, computed, providedSignature))
+
+	return true
+}
+
+// Verify unwraps the update site file, canonicalises it without its signature and checks the digests,
+// the signatures and the certificate chain against the roots, stopping at the first step others depend on
+func Verify(data []byte, roots *x509.CertPool, now time.Time) *Report {
+	r := &Report{}
+
+	format, data, err := unwrap(data)
+	if !r.add("format", format, err) {
+		return r
+	}
+
+	var signed struct {
+		Signature *types.Signature `json:"signature"`
+	}
+
+	if !r.add("parsing", "", json.Unmarshal(data, &signed)) {
+		return r
+	}
+
+	doc, err := signapi.Canonicalize(bytes.NewReader(data))
+	if !r.add("canonicalisation", fmt.Sprintf("%d bytes", len(doc)), err) {
+		return r
+	}
+
+	if signed.Signature == nil {
+		r.add("signature", "", errNotPresent)
+		return r
+	}
+
+	certs, err := signed.Signature.GetCertificates()
+	if err == nil && len(certs) == 0 {
+		err = errNotPresent
+	}
+
+	subjects := make([]string, 0, len(certs))
+	for _, cert := range certs {
+		subjects = append(subjects, cert.Subject.String())
+	}
+
+	if !r.add("certificates", strings.Join(subjects, " <- "), err) {
+		return r
+	}
+
+	r.add("certificate chain", "", signer.VerifyCertificateChain(certs, roots, now))
+
+	pub, ok := certs[0].PublicKey.(*rsa.PublicKey)
+	if !ok {
+		r.add("public key", certs[0].PublicKeyAlgorithm.String(), fmt.Errorf("RSA key expected"))
+		return r
+	}
+
+	sha512Digest := sha512.Sum512(doc)
+	sha1Digest := sha1.Sum(doc) //nolint:gosec
+
+	present := r.checkDigest("SHA-512", pub, crypto.SHA512, sha512Digest[:], signed.Signature.CorrectDigest512, signed.Signature.CorrectSignature512)
+	present = r.checkDigest("SHA-1", pub, crypto.SHA1, sha1Digest[:], signed.Signature.CorrectDigest, signed.Signature.CorrectSignature) || present
+
+	if !present {
+		r.add("digests", "", errNotPresent)
+	}
+
+	return r
+}
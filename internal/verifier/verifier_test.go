@@ -0,0 +1,103 @@
+package verifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"os"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/config"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/signer"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/jenkins/sourcefileproviders"
+	"github.com/kruftik/jenkins-update-dot-json-resigner/internal/signapi"
+)
+
+func TestVerify(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+
+	signerSvc, err := signer.NewSignerService(logger.Sugar(), config.SignerConfig{
+		CertificatePath: "../../testdata/certs/test.crt",
+		KeyPath:         "../../testdata/certs/test.key",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile("../../testdata/update-center/update-center.raw.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := signapi.Canonicalize(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature, err := signerSvc.GetSignature(context.Background(), doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := doc.WithSignature(signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots, err := signer.LoadTrustStore("../../testdata/certs/test.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(roots[0])
+
+	wrap := func(prefix, suffix []byte) []byte {
+		return append(append(append([]byte{}, prefix...), signed...), suffix...)
+	}
+
+	for format, data := range map[string][]byte{
+		FormatJSON:  signed,
+		FormatJSONP: wrap(sourcefileproviders.WrappedJSONPPrefix, sourcefileproviders.WrappedJSONPSuffix),
+		FormatHTML:  wrap(sourcefileproviders.WrappedHTMLPrefix, sourcefileproviders.WrappedHTMLSuffix),
+	} {
+		report := Verify(data, pool, time.Now())
+		if !report.OK() {
+			t.Fatalf("%s file rejected: %+v", format, report.Steps)
+		}
+
+		if report.Steps[0].Detail != format {
+			t.Fatalf("%s file detected as %s", format, report.Steps[0].Detail)
+		}
+	}
+
+	failedStep := func(report *Report) string {
+		for _, step := range report.Steps {
+			if step.Err != nil {
+				return step.Name
+			}
+		}
+
+		return ""
+	}
+
+	tampered := bytes.Replace(signed, []byte(`"connectionCheckUrl":"https://www.google.com/"`), []byte(`"connectionCheckUrl":"https://example.com/"`), 1)
+	if step := failedStep(Verify(tampered, pool, time.Now())); step != "SHA-512 digest" {
+		t.Fatalf("tampered file failed at %q", step)
+	}
+
+	if step := failedStep(Verify(signed, x509.NewCertPool(), time.Now())); step != "certificate chain" {
+		t.Fatalf("untrusted file failed at %q", step)
+	}
+
+	if step := failedStep(Verify(signed, pool, time.Now().AddDate(20, 0, 0))); step != "certificate chain" {
+		t.Fatalf("expired certificate failed at %q", step)
+	}
+
+	if step := failedStep(Verify(doc, pool, time.Now())); step != "signature" {
+		t.Fatalf("unsigned file failed at %q", step)
+	}
+}